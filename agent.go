@@ -14,10 +14,14 @@ import (
 func main() {
 	ctx := context.Background()
 
+	// Load OpenRouter settings from OPENROUTER_* environment variables
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	// Create OpenRouter model using our custom wrapper
-	model, err := NewOpenRouterModel("x-ai/grok-code-fast-1", &OpenRouterConfig{
-		APIKey: os.Getenv("OPENROUTER_API_KEY"),
-	})
+	model, err := NewOpenRouterModel("x-ai/grok-code-fast-1", cfg)
 	if err != nil {
 		log.Fatalf("Failed to create model: %v", err)
 	}
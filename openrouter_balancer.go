@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+)
+
+// defaultRateLimitCooldown is how long LoadBalancer skips a model after it
+// was rate limited, when no cooldown is configured.
+const defaultRateLimitCooldown = 30 * time.Second
+
+// LoadBalancer spreads calls over several equivalent models in round-robin
+// order. A model that fails with a rate-limit error, or whose last response
+// reported no requests remaining, is skipped until it recovers. It implements
+// model.LLM, so it can be used wherever a single model is.
+type LoadBalancer struct {
+	models   []*OpenRouterModel
+	cooldown time.Duration
+	next     atomic.Uint64
+
+	mu sync.Mutex
+	// limitedUntil holds, per model, when a rate-limit cooldown ends.
+	limitedUntil []time.Time
+}
+
+var _ model.LLM = (*LoadBalancer)(nil)
+
+// NewLoadBalancer returns a LoadBalancer over models. A rate-limited model is
+// skipped for cooldown, or 30 seconds when cooldown is zero.
+func NewLoadBalancer(models []*OpenRouterModel, cooldown time.Duration) (*LoadBalancer, error) {
+	if len(models) == 0 {
+		return nil, errors.New("load balancer requires at least one model")
+	}
+	if cooldown <= 0 {
+		cooldown = defaultRateLimitCooldown
+	}
+	return &LoadBalancer{
+		models:       models,
+		cooldown:     cooldown,
+		limitedUntil: make([]time.Time, len(models)),
+	}, nil
+}
+
+// Name returns the name of the first model.
+func (b *LoadBalancer) Name() string {
+	return b.models[0].Name()
+}
+
+// GenerateContent implements the model.LLM interface, sending the call to the
+// next available model.
+func (b *LoadBalancer) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		i := b.pick()
+		for resp, err := range b.models[i].GenerateContent(ctx, req, stream) {
+			if err != nil && isRateLimitError(err) {
+				b.markLimited(i)
+			}
+			if !yield(resp, err) {
+				return
+			}
+		}
+	}
+}
+
+// pick returns the index of the next model in round-robin order that is not
+// rate limited. When all are, the round-robin choice is used anyway.
+func (b *LoadBalancer) pick() int {
+	start := int(b.next.Add(1)-1) % len(b.models)
+	now := time.Now()
+	for offset := range len(b.models) {
+		i := (start + offset) % len(b.models)
+		if b.available(i, now) {
+			return i
+		}
+	}
+	return start
+}
+
+// available reports whether model i may be used at now.
+func (b *LoadBalancer) available(i int, now time.Time) bool {
+	b.mu.Lock()
+	limited := now.Before(b.limitedUntil[i])
+	b.mu.Unlock()
+	if limited {
+		return false
+	}
+	info := b.models[i].LastRateLimit()
+	return info.Limit == 0 || info.Remaining > 0 || !now.Before(info.Reset)
+}
+
+// markLimited starts a cooldown for model i.
+func (b *LoadBalancer) markLimited(i int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limitedUntil[i] = time.Now().Add(b.cooldown)
+}
+
+// isRateLimitError reports whether err is an HTTP 429 from the API.
+func isRateLimitError(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// balancedModel returns a model backed by a fake answering with text.
+func balancedModel(text string) (*OpenRouterModel, *fakeChatClient) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion(text, openai.FinishReasonStop)}}}
+	return &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}, fake
+}
+
+func TestLoadBalancer_RoundRobin(t *testing.T) {
+	first, firstFake := balancedModel("first")
+	second, secondFake := balancedModel("second")
+	b, err := NewLoadBalancer([]*OpenRouterModel{first, second}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for range 4 {
+		responses, err := collect(b.GenerateContent(context.Background(), userRequest("Hi"), false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, responses[0].Content.Parts[0].Text)
+	}
+
+	want := []string{"first", "second", "first", "second"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected calls to alternate %v, got %v", want, got)
+		}
+	}
+	if len(firstFake.requests) != 2 || len(secondFake.requests) != 2 {
+		t.Errorf("expected 2 requests per model, got %d and %d", len(firstFake.requests), len(secondFake.requests))
+	}
+}
+
+func TestLoadBalancer_SkipsRateLimited(t *testing.T) {
+	limited := &fakeChatClient{completions: []fakeCompletion{{
+		err: &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "Rate limit exceeded"},
+	}}}
+	first := &OpenRouterModel{chat: limited, modelName: "openai/gpt-4"}
+	second, secondFake := balancedModel("second")
+	b, err := NewLoadBalancer([]*OpenRouterModel{first, second}, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = collect(b.GenerateContent(context.Background(), userRequest("Hi"), false))
+	if !isRateLimitError(err) {
+		t.Fatalf("expected the rate-limit error to be passed through, got %v", err)
+	}
+	for range 3 {
+		if _, err := collect(b.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(limited.requests) != 1 {
+		t.Errorf("expected the rate-limited model to be skipped, got %d requests", len(limited.requests))
+	}
+	if len(secondFake.requests) != 3 {
+		t.Errorf("expected the other model to take the remaining calls, got %d", len(secondFake.requests))
+	}
+}
+
+func TestLoadBalancer_SkipsExhaustedRateLimit(t *testing.T) {
+	first, firstFake := balancedModel("first")
+	first.rateLimit = &rateLimitTracker{}
+	first.rateLimit.store(RateLimitInfo{Limit: 10, Remaining: 0, Reset: time.Now().Add(time.Minute)})
+	second, secondFake := balancedModel("second")
+	b, err := NewLoadBalancer([]*OpenRouterModel{first, second}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for range 2 {
+		if _, err := collect(b.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(firstFake.requests) != 0 || len(secondFake.requests) != 2 {
+		t.Errorf("expected only the model with requests left to be used, got %d and %d", len(firstFake.requests), len(secondFake.requests))
+	}
+}
+
+func TestLoadBalancer_AllRateLimited(t *testing.T) {
+	first, firstFake := balancedModel("first")
+	b, err := NewLoadBalancer([]*OpenRouterModel{first}, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b.markLimited(0)
+
+	if _, err := collect(b.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(firstFake.requests) != 1 {
+		t.Errorf("expected a call to go out when every model is limited, got %d requests", len(firstFake.requests))
+	}
+}
+
+func TestNewLoadBalancer_NoModels(t *testing.T) {
+	if _, err := NewLoadBalancer(nil, 0); err == nil {
+		t.Error("expected an error without models")
+	}
+}
+
+func TestIsRateLimitError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"api 429", &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}, true},
+		{"request 429", &openai.RequestError{HTTPStatusCode: http.StatusTooManyRequests}, true},
+		{"api 500", &openai.APIError{HTTPStatusCode: http.StatusInternalServerError}, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRateLimitError(tt.err); got != tt.want {
+				t.Errorf("isRateLimitError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
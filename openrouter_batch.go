@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/adk/model"
+)
+
+// BatchResult is the outcome of one request in a GenerateBatch call.
+type BatchResult struct {
+	// Response is the final response, or nil if the call failed.
+	Response *model.LLMResponse
+	// Err is the error the call failed with, if any.
+	Err error
+}
+
+// GenerateBatch runs independent non-streaming requests with at most
+// concurrency calls in flight, returning results in the order of reqs. Each
+// call goes through GenerateContent, so the retry settings apply per call.
+// Requests not yet started when ctx is cancelled fail with ctx.Err().
+func (m *OpenRouterModel) GenerateBatch(ctx context.Context, reqs []*model.LLMRequest, concurrency int) []BatchResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]BatchResult, len(reqs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, req := range reqs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = m.generateOne(ctx, req)
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// generateOne runs a single non-streaming request and returns its final response.
+func (m *OpenRouterModel) generateOne(ctx context.Context, req *model.LLMRequest) BatchResult {
+	if err := ctx.Err(); err != nil {
+		return BatchResult{Err: err}
+	}
+	var final *model.LLMResponse
+	for resp, err := range m.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return BatchResult{Err: err}
+		}
+		final = resp
+	}
+	if final == nil {
+		return BatchResult{Err: fmt.Errorf("openrouter returned no response")}
+	}
+	return BatchResult{Response: final}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+)
+
+// echoChatClient is a concurrency-safe chatClient that answers each request
+// with its last message after a short delay, tracking peak concurrency.
+type echoChatClient struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	delay    time.Duration
+	// fail makes requests with this prompt fail.
+	fail string
+}
+
+func (c *echoChatClient) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.peak = max(c.peak, c.inFlight)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return openai.ChatCompletionResponse{}, ctx.Err()
+	}
+
+	prompt := req.Messages[len(req.Messages)-1].Content
+	if prompt == c.fail {
+		return openai.ChatCompletionResponse{}, errors.New("upstream failure")
+	}
+	return textCompletion("echo: "+prompt, openai.FinishReasonStop), nil
+}
+
+func (c *echoChatClient) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (chatStream, error) {
+	return nil, errors.New("echoChatClient: streaming not supported")
+}
+
+// ============================================================================
+// GenerateBatch Tests
+// ============================================================================
+
+func TestGenerateBatch_OrderedResults(t *testing.T) {
+	chat := &echoChatClient{delay: 10 * time.Millisecond, fail: "p3"}
+	m := &OpenRouterModel{chat: chat, modelName: "openai/gpt-4"}
+	prompts := []string{"p0", "p1", "p2", "p3", "p4", "p5", "p6"}
+	reqs := make([]*model.LLMRequest, len(prompts))
+	for i, p := range prompts {
+		reqs[i] = userRequest(p)
+	}
+
+	results := m.GenerateBatch(context.Background(), reqs, 3)
+
+	if len(results) != len(prompts) {
+		t.Fatalf("expected %d results, got %d", len(prompts), len(results))
+	}
+	for i, result := range results {
+		if prompts[i] == "p3" {
+			if result.Err == nil || result.Response != nil {
+				t.Errorf("result %d: expected an error only, got %+v", i, result)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Errorf("result %d: unexpected error: %v", i, result.Err)
+			continue
+		}
+		if got := result.Response.Content.Parts[0].Text; got != "echo: "+prompts[i] {
+			t.Errorf("result %d: expected %q, got %q", i, "echo: "+prompts[i], got)
+		}
+	}
+	if chat.peak > 3 {
+		t.Errorf("expected at most 3 calls in flight, saw %d", chat.peak)
+	}
+	if chat.peak < 2 {
+		t.Errorf("expected calls to run concurrently, peak was %d", chat.peak)
+	}
+}
+
+func TestGenerateBatch_Cancelled(t *testing.T) {
+	chat := &echoChatClient{delay: time.Second}
+	m := &OpenRouterModel{chat: chat, modelName: "openai/gpt-4"}
+	reqs := []*model.LLMRequest{userRequest("a"), userRequest("b"), userRequest("c")}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results := m.GenerateBatch(ctx, reqs, 1)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the batch to stop promptly, took %v", elapsed)
+	}
+	for i, result := range results {
+		if !errors.Is(result.Err, context.DeadlineExceeded) {
+			t.Errorf("result %d: expected context.DeadlineExceeded, got %v", i, result.Err)
+		}
+	}
+}
+
+func TestGenerateBatch_Empty(t *testing.T) {
+	m := &OpenRouterModel{chat: &echoChatClient{}, modelName: "openai/gpt-4"}
+
+	if results := m.GenerateBatch(context.Background(), nil, 4); len(results) != 0 {
+		t.Errorf("expected no results, got %d", len(results))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// Cache stores final responses of deterministic calls, keyed by a hash of the
+// request sent to OpenRouter. Implementations must be safe for concurrent
+// use; an in-memory map behind a mutex or a Redis client both fit.
+type Cache interface {
+	// Get returns the response stored under key, if any.
+	Get(ctx context.Context, key string) (*model.LLMResponse, bool)
+	// Set stores resp under key.
+	Set(ctx context.Context, key string, resp *model.LLMResponse)
+}
+
+// CachedMetadataKey is the LLMResponse.CustomMetadata key set to true on
+// responses served from the Cache.
+const CachedMetadataKey = "openrouter_cached"
+
+// ResponseCached reports whether resp was served from the Cache.
+func ResponseCached(resp *model.LLMResponse) bool {
+	if resp == nil {
+		return false
+	}
+	cached, _ := resp.CustomMetadata[CachedMetadataKey].(bool)
+	return cached
+}
+
+// isDeterministic reports whether req asks for greedy decoding, the only
+// case where a cached response stands in for a fresh one.
+func isDeterministic(req *model.LLMRequest) bool {
+	return req.Config != nil && req.Config.Temperature != nil && *req.Config.Temperature == 0
+}
+
+// cacheKey returns the hex SHA-256 of the canonical JSON of the converted
+// request together with the OpenRouter-only fields sent with it.
+func (m *OpenRouterModel) cacheKey(openaiReq openai.ChatCompletionRequest) (string, error) {
+	data, err := canonicalJSON(struct {
+		Request openai.ChatCompletionRequest `json:"request"`
+		Extra   map[string]any               `json:"extra"`
+	}{openaiReq, m.extraBody()})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cachingYield wraps yield so that a successful final response is stored
+// in the cache under key.
+func (m *OpenRouterModel) cachingYield(ctx context.Context, key string, yield func(*model.LLMResponse, error) bool) func(*model.LLMResponse, error) bool {
+	return func(resp *model.LLMResponse, err error) bool {
+		if err == nil && resp != nil && !resp.Partial && resp.ErrorCode == "" {
+			// The caller and later hooks may modify resp, so the cache
+			// gets its own copy
+			m.cfg.Cache.Set(ctx, key, cloneResponse(resp))
+		}
+		return yield(resp, err)
+	}
+}
+
+// cacheHit returns the copy of cached served on a cache hit. No call was
+// made, so the usage, cost and generation ID of the original call are
+// dropped rather than reported again, and the response is marked as cached.
+func cacheHit(cached *model.LLMResponse) *model.LLMResponse {
+	resp := cloneResponse(cached)
+	resp.UsageMetadata = nil
+	delete(resp.CustomMetadata, CostMetadataKey)
+	delete(resp.CustomMetadata, GenerationIDMetadataKey)
+	if resp.CustomMetadata == nil {
+		resp.CustomMetadata = make(map[string]any)
+	}
+	resp.CustomMetadata[CachedMetadataKey] = true
+	return resp
+}
+
+// cloneResponse returns a copy of resp that shares no mutable state with it:
+// the content, its parts and the metadata are copied. Cached responses pass
+// through it in both directions, so editing a served response never alters
+// the cache entry.
+func cloneResponse(resp *model.LLMResponse) *model.LLMResponse {
+	clone := *resp
+	if resp.Content != nil {
+		content := *resp.Content
+		content.Parts = make([]*genai.Part, len(resp.Content.Parts))
+		for i, part := range resp.Content.Parts {
+			content.Parts[i] = clonePart(part)
+		}
+		clone.Content = &content
+	}
+	if resp.CitationMetadata != nil {
+		citations := *resp.CitationMetadata
+		citations.Citations = make([]*genai.Citation, len(resp.CitationMetadata.Citations))
+		for i, citation := range resp.CitationMetadata.Citations {
+			c := *citation
+			citations.Citations[i] = &c
+		}
+		clone.CitationMetadata = &citations
+	}
+	if resp.UsageMetadata != nil {
+		usage := *resp.UsageMetadata
+		clone.UsageMetadata = &usage
+	}
+	clone.CustomMetadata = maps.Clone(resp.CustomMetadata)
+	return &clone
+}
+
+// clonePart copies a part along with its function call, function response
+// and inline data.
+func clonePart(part *genai.Part) *genai.Part {
+	if part == nil {
+		return nil
+	}
+	clone := *part
+	if part.FunctionCall != nil {
+		call := *part.FunctionCall
+		call.Args = maps.Clone(part.FunctionCall.Args)
+		clone.FunctionCall = &call
+	}
+	if part.FunctionResponse != nil {
+		response := *part.FunctionResponse
+		response.Response = maps.Clone(part.FunctionResponse.Response)
+		clone.FunctionResponse = &response
+	}
+	if part.InlineData != nil {
+		blob := *part.InlineData
+		blob.Data = bytes.Clone(part.InlineData.Data)
+		clone.InlineData = &blob
+	}
+	return &clone
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// memoryCache is a minimal in-memory Cache.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*model.LLMResponse
+	hits    int
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (*model.LLMResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, ok := c.entries[key]
+	if ok {
+		c.hits++
+	}
+	return resp, ok
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, resp *model.LLMResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*model.LLMResponse)
+	}
+	c.entries[key] = resp
+}
+
+// greedyRequest builds a user request with temperature 0.
+func greedyRequest(text string) *model.LLMRequest {
+	req := userRequest(text)
+	req.Config = &genai.GenerateContentConfig{Temperature: genai.Ptr[float32](0)}
+	return req
+}
+
+func TestCache_ServesRepeatedCall(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("Paris", openai.FinishReasonStop)}}}
+	cache := &memoryCache{}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Cache: cache}}
+
+	first, err := collect(m.GenerateContent(context.Background(), greedyRequest("Capital of France?"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := collect(m.GenerateContent(context.Background(), greedyRequest("Capital of France?"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fake.requests) != 1 {
+		t.Errorf("expected the second call to be served from cache, got %d API calls", len(fake.requests))
+	}
+	if cache.hits != 1 {
+		t.Errorf("expected 1 cache hit, got %d", cache.hits)
+	}
+	if len(second) != 1 || second[0].Content.Parts[0].Text != first[0].Content.Parts[0].Text {
+		t.Errorf("expected the cached response, got %+v", second)
+	}
+}
+
+func TestCache_HitDropsCostAndUsage(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("Paris", openai.FinishReasonStop)}}}
+	cache := &memoryCache{}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Cache: cache}}
+
+	first, err := collect(m.GenerateContent(context.Background(), greedyRequest("Capital of France?"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ResponseCached(first[0]) {
+		t.Error("expected the first response not to be marked as cached")
+	}
+	// Record what the original call reported, as IncludeCost would
+	for _, resp := range cache.entries {
+		resp.UsageMetadata = &genai.GenerateContentResponseUsageMetadata{TotalTokenCount: 12}
+		resp.CustomMetadata = map[string]any{CostMetadataKey: 0.25, GenerationIDMetadataKey: "gen-1"}
+	}
+
+	second, err := collect(m.GenerateContent(context.Background(), greedyRequest("Capital of France?"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hit := second[0]
+	if !ResponseCached(hit) {
+		t.Error("expected the hit to be marked as cached")
+	}
+	if cost, ok := ResponseCost(hit); ok {
+		t.Errorf("expected no cost on a cache hit, got %v", cost)
+	}
+	if id, ok := ResponseGenerationID(hit); ok {
+		t.Errorf("expected no generation ID on a cache hit, got %q", id)
+	}
+	if hit.UsageMetadata != nil {
+		t.Errorf("expected no usage on a cache hit, got %+v", hit.UsageMetadata)
+	}
+}
+
+func TestCache_StreamingHitYieldsFinalResponse(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Par", ""),
+		textChunk("is", openai.FinishReasonStop),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Cache: &memoryCache{}}}
+
+	if _, err := collect(m.GenerateContent(context.Background(), greedyRequest("Capital of France?"), true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	responses, err := collect(m.GenerateContent(context.Background(), greedyRequest("Capital of France?"), true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fake.requests) != 1 {
+		t.Errorf("expected 1 API call, got %d", len(fake.requests))
+	}
+	if len(responses) != 1 || responses[0].Partial || responses[0].Content.Parts[0].Text != "Paris" {
+		t.Errorf("expected only the cached final response, got %+v", responses)
+	}
+}
+
+func TestCache_SkipsNonDeterministicRequests(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("Hi", openai.FinishReasonStop)}}}
+	cache := &memoryCache{}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Cache: cache}}
+	warm := userRequest("Hi")
+	warm.Config = &genai.GenerateContentConfig{Temperature: genai.Ptr[float32](0.7)}
+
+	for _, req := range []*model.LLMRequest{userRequest("Hi"), userRequest("Hi"), warm, warm} {
+		if _, err := collect(m.GenerateContent(context.Background(), req, false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(fake.requests) != 4 {
+		t.Errorf("expected every call to reach the API, got %d calls", len(fake.requests))
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("expected nothing cached, got %d entries", len(cache.entries))
+	}
+}
+
+func TestCache_KeyDependsOnRequest(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("Hi", openai.FinishReasonStop)}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Cache: &memoryCache{}}}
+
+	ctx := context.Background()
+	for _, run := range []struct {
+		ctx context.Context
+		req *model.LLMRequest
+	}{
+		{ctx, greedyRequest("Capital of France?")},
+		{ctx, greedyRequest("Capital of Spain?")},
+		{ContextWithModel(ctx, "anthropic/claude-3-haiku"), greedyRequest("Capital of France?")},
+	} {
+		if _, err := collect(m.GenerateContent(run.ctx, run.req, false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(fake.requests) != 3 {
+		t.Errorf("expected distinct requests to miss the cache, got %d API calls", len(fake.requests))
+	}
+}
+
+func TestCache_HitsUnaffectedByHookChanges(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("secret", openai.FinishReasonStop)}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		Cache: &memoryCache{},
+		AfterResponse: func(resp *model.LLMResponse) {
+			resp.Content.Parts[0].Text += "!"
+			resp.CustomMetadata = map[string]any{"seen": true}
+		},
+	}}
+
+	for i := range 3 {
+		responses, err := collect(m.GenerateContent(context.Background(), greedyRequest("Tell me"), false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if text := responses[0].Content.Parts[0].Text; text != "secret!" {
+			t.Errorf("call %d: expected %q, got %q", i+1, "secret!", text)
+		}
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("expected later calls to be served from cache, got %d API calls", len(fake.requests))
+	}
+}
+
+func TestCache_HitsUnaffectedByContinue(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion(" world", openai.FinishReasonStop)}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Cache: &memoryCache{}}}
+	prevResp := &model.LLMResponse{Content: genai.NewContentFromText("hello", genai.RoleModel)}
+
+	for i := range 3 {
+		responses, err := collect(m.Continue(context.Background(), greedyRequest("Greet"), prevResp, false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if text := responses[0].Content.Parts[0].Text; text != "hello world" {
+			t.Errorf("call %d: expected %q, got %q", i+1, "hello world", text)
+		}
+	}
+}
+
+func TestCloneResponse_SharesNothing(t *testing.T) {
+	resp := &model.LLMResponse{
+		Content: &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{
+			genai.NewPartFromText("hi"),
+			genai.NewPartFromFunctionCall("get_time", map[string]any{"city": "Paris"}),
+		}},
+		CustomMetadata: map[string]any{"openrouter_cost": 0.1},
+	}
+
+	clone := cloneResponse(resp)
+	clone.Content.Parts[0].Text = "changed"
+	clone.Content.Parts[1].FunctionCall.Args["city"] = "Rome"
+	clone.Content.Parts = append(clone.Content.Parts, genai.NewPartFromText("extra"))
+	clone.CustomMetadata["openrouter_cost"] = 9.9
+
+	if resp.Content.Parts[0].Text != "hi" || len(resp.Content.Parts) != 2 {
+		t.Errorf("expected the original parts to be untouched, got %+v", resp.Content.Parts)
+	}
+	if resp.Content.Parts[1].FunctionCall.Args["city"] != "Paris" {
+		t.Errorf("expected the original args to be untouched, got %v", resp.Content.Parts[1].FunctionCall.Args)
+	}
+	if resp.CustomMetadata["openrouter_cost"] != 0.1 {
+		t.Errorf("expected the original metadata to be untouched, got %v", resp.CustomMetadata)
+	}
+}
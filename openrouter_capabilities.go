@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Feature is a model capability that Supports can report on.
+type Feature string
+
+// Features tracked by the capability table.
+const (
+	// FeatureVision is image input
+	FeatureVision Feature = "vision"
+	// FeatureTools is function calling
+	FeatureTools Feature = "tools"
+	// FeatureReasoning is exposed reasoning tokens
+	FeatureReasoning Feature = "reasoning"
+)
+
+// modelCapabilities maps model name prefixes to the features of the models
+// they match. The longest matching prefix wins, so a prefix also covers dated
+// releases of its model (e.g. "openai/gpt-4o-2024-08-06"). A sibling whose
+// name extends another entry's but whose features differ, such as
+// "openai/o3-mini" next to "openai/o3", needs an entry of its own.
+var modelCapabilities = map[string][]Feature{
+	"openai/gpt-3.5-turbo":            {FeatureTools},
+	"openai/gpt-4":                    {FeatureTools},
+	"openai/gpt-4-turbo":              {FeatureVision, FeatureTools},
+	"openai/gpt-4-turbo-preview":      {FeatureTools},
+	"openai/gpt-4-vision-preview":     {FeatureVision},
+	"openai/gpt-4o":                   {FeatureVision, FeatureTools},
+	"openai/gpt-4.1":                  {FeatureVision, FeatureTools},
+	"openai/gpt-5":                    {FeatureVision, FeatureTools, FeatureReasoning},
+	"openai/o1":                       {FeatureVision, FeatureTools, FeatureReasoning},
+	"openai/o1-mini":                  {FeatureReasoning},
+	"openai/o1-preview":               {FeatureReasoning},
+	"openai/o3":                       {FeatureVision, FeatureTools, FeatureReasoning},
+	"openai/o3-mini":                  {FeatureTools, FeatureReasoning},
+	"openai/o4-mini":                  {FeatureVision, FeatureTools, FeatureReasoning},
+	"anthropic/claude-3":              {FeatureVision, FeatureTools},
+	"anthropic/claude-3.7-sonnet":     {FeatureVision, FeatureTools, FeatureReasoning},
+	"anthropic/claude-sonnet-4":       {FeatureVision, FeatureTools, FeatureReasoning},
+	"anthropic/claude-opus-4":         {FeatureVision, FeatureTools, FeatureReasoning},
+	"google/gemini":                   {FeatureVision, FeatureTools},
+	"google/gemini-pro":               {FeatureTools},
+	"google/gemini-pro-1.5":           {FeatureVision, FeatureTools},
+	"google/gemini-pro-vision":        {FeatureVision},
+	"google/gemini-2.5":               {FeatureVision, FeatureTools, FeatureReasoning},
+	"deepseek/deepseek-chat":          {FeatureTools},
+	"deepseek/deepseek-r1":            {FeatureReasoning},
+	"meta-llama/llama-3.2-11b-vision": {FeatureVision},
+	"meta-llama/llama-3.2-90b-vision": {FeatureVision},
+	"mistralai/mistral-large":         {FeatureTools},
+	"x-ai/grok-3":                     {FeatureTools},
+	"x-ai/grok-3-mini":                {FeatureTools, FeatureReasoning},
+	"x-ai/grok-4":                     {FeatureVision, FeatureTools, FeatureReasoning},
+}
+
+// Supports reports whether the model calls with ctx are sent to, including a
+// ContextWithModel override, is known to support feature. Models
+// missing from the capability table report false for every feature, so a
+// false result means "not known to", not "known not to".
+func (m *OpenRouterModel) Supports(ctx context.Context, feature Feature) bool {
+	return slices.Contains(modelFeatures(m.requestModel(ctx)), feature)
+}
+
+// modelFeatures returns the features of the longest capability table prefix
+// matching name. Variant suffixes such as ":online" are ignored.
+func modelFeatures(name string) []Feature {
+	name, _, _ = strings.Cut(strings.ToLower(name), ":")
+	var best string
+	for prefix := range modelCapabilities {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return modelCapabilities[best]
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOpenRouterModel_Supports(t *testing.T) {
+	tests := []struct {
+		modelName string
+		feature   Feature
+		want      bool
+	}{
+		{"openai/gpt-4o", FeatureVision, true},
+		{"openai/gpt-4o", FeatureTools, true},
+		{"openai/gpt-4o", FeatureReasoning, false},
+		{"openai/gpt-4o-mini", FeatureVision, true},
+		{"openai/gpt-4", FeatureVision, false},
+		{"openai/gpt-3.5-turbo", FeatureVision, false},
+		{"openai/gpt-3.5-turbo", FeatureTools, true},
+		{"openai/o1-mini", FeatureTools, false},
+		{"openai/o3", FeatureVision, true},
+		{"openai/o3-mini", FeatureVision, false},
+		{"openai/o3-mini", FeatureTools, true},
+		{"openai/o3-mini-high", FeatureReasoning, true},
+		{"openai/gpt-4-turbo", FeatureVision, true},
+		{"openai/gpt-4-turbo-preview", FeatureVision, false},
+		{"openai/gpt-4o-2024-08-06", FeatureVision, true},
+		{"google/gemini-pro", FeatureVision, false},
+		{"google/gemini-pro-1.5", FeatureVision, true},
+		{"google/gemini-2.0-flash-001", FeatureVision, true},
+		{"x-ai/grok-3-mini", FeatureReasoning, true},
+		{"x-ai/grok-3", FeatureReasoning, false},
+		{"anthropic/claude-3.5-sonnet", FeatureVision, true},
+		{"deepseek/deepseek-r1", FeatureReasoning, true},
+		{"deepseek/deepseek-r1", FeatureVision, false},
+		{"google/gemini-2.5-pro:online", FeatureReasoning, true},
+		{"unknown/model", FeatureTools, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.modelName+"/"+string(tt.feature), func(t *testing.T) {
+			m := &OpenRouterModel{modelName: tt.modelName}
+			if got := m.Supports(context.Background(), tt.feature); got != tt.want {
+				t.Errorf("Supports(%q) = %v, want %v", tt.feature, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// chatClient is the subset of the OpenAI client used for chat completions.
+// OpenRouterModel depends on it rather than *openai.Client so tests can
+// substitute a fake without network access.
+type chatClient interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (chatStream, error)
+}
+
+// chatStream is a stream of chat completion chunks, as returned by
+// (*openai.Client).CreateChatCompletionStream.
+type chatStream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// openaiChatClient adapts *openai.Client to the chatClient interface.
+type openaiChatClient struct {
+	client *openai.Client
+}
+
+func (c openaiChatClient) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return c.client.CreateChatCompletion(ctx, req)
+}
+
+func (c openaiChatClient) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (chatStream, error) {
+	stream, err := c.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
@@ -0,0 +1,1351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// fakeChatClient is an in-memory chatClient. CreateChatCompletion returns
+// completions in order (repeating the last one) and CreateChatCompletionStream
+// replays chunks. Every request is recorded.
+type fakeChatClient struct {
+	completions []fakeCompletion
+	chunks      []openai.ChatCompletionStreamResponse
+	// streamErr, if set, is returned by Recv after all chunks instead of io.EOF.
+	streamErr error
+	// hang makes Recv block after all chunks until the context is done, like
+	// a stalled connection.
+	hang     bool
+	requests []openai.ChatCompletionRequest
+}
+
+// fakeCompletion is a canned CreateChatCompletion result.
+type fakeCompletion struct {
+	resp openai.ChatCompletionResponse
+	err  error
+}
+
+func (f *fakeChatClient) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	f.requests = append(f.requests, req)
+	if len(f.completions) == 0 {
+		return openai.ChatCompletionResponse{}, errors.New("fake: no completions configured")
+	}
+	idx := min(len(f.requests), len(f.completions)) - 1
+	return f.completions[idx].resp, f.completions[idx].err
+}
+
+func (f *fakeChatClient) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (chatStream, error) {
+	f.requests = append(f.requests, req)
+	stream := &fakeStream{chunks: f.chunks, err: f.streamErr}
+	if f.hang {
+		stream.ctx = ctx
+	}
+	return stream, nil
+}
+
+// fakeStream replays chunks, then returns err (or io.EOF when err is nil).
+// With ctx set it instead blocks until ctx is done.
+type fakeStream struct {
+	chunks []openai.ChatCompletionStreamResponse
+	pos    int
+	err    error
+	ctx    context.Context
+	closed bool
+}
+
+func (s *fakeStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if s.pos >= len(s.chunks) {
+		if s.ctx != nil {
+			<-s.ctx.Done()
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("read body: %w", s.ctx.Err())
+		}
+		if s.err != nil {
+			return openai.ChatCompletionStreamResponse{}, s.err
+		}
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := s.chunks[s.pos]
+	s.pos++
+	return chunk, nil
+}
+
+func (s *fakeStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+// textChunk builds a stream chunk carrying a content delta.
+func textChunk(text string, finish openai.FinishReason) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        openai.ChatCompletionStreamChoiceDelta{Content: text},
+			FinishReason: finish,
+		}},
+	}
+}
+
+// textCompletion builds a single-choice completion with text content.
+func textCompletion(text string, finish openai.FinishReason) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+			FinishReason: finish,
+		}},
+	}
+}
+
+// collect drains seq, returning every response yielded before the first error.
+func collect(seq iter.Seq2[*model.LLMResponse, error]) ([]*model.LLMResponse, error) {
+	var responses []*model.LLMResponse
+	for resp, err := range seq {
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+// userRequest builds a request with a single user text message.
+func userRequest(text string) *model.LLMRequest {
+	return &model.LLMRequest{
+		Contents: []*genai.Content{genai.NewContentFromText(text, genai.RoleUser)},
+	}
+}
+
+// ============================================================================
+// Non-Streaming Tests
+// ============================================================================
+
+func TestGenerateContent_NonStreaming(t *testing.T) {
+	resp := textCompletion("Hello there!", openai.FinishReasonStop)
+	resp.Usage = openai.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: resp}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("expected 1 response, got %d", len(responses))
+	}
+	got := responses[0]
+	if got.Content.Parts[0].Text != "Hello there!" {
+		t.Errorf("expected text 'Hello there!', got %q", got.Content.Parts[0].Text)
+	}
+	if !got.TurnComplete {
+		t.Error("expected TurnComplete to be true")
+	}
+	if got.FinishReason != genai.FinishReasonStop {
+		t.Errorf("expected finish reason STOP, got %v", got.FinishReason)
+	}
+	if got.UsageMetadata == nil || got.UsageMetadata.TotalTokenCount != 8 {
+		t.Errorf("expected total token count 8, got %+v", got.UsageMetadata)
+	}
+	if len(fake.requests) != 1 || fake.requests[0].Model != "openai/gpt-4" {
+		t.Errorf("expected one request for 'openai/gpt-4', got %+v", fake.requests)
+	}
+	if fake.requests[0].Stream {
+		t.Error("expected non-streaming request")
+	}
+}
+
+func TestGenerateContent_NonStreamingNoChoices(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: openai.ChatCompletionResponse{}}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if err == nil {
+		t.Fatal("expected error for response with no choices")
+	}
+	if err.Error() != "openrouter returned no choices" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	if len(responses) != 0 {
+		t.Errorf("expected no responses, got %d", len(responses))
+	}
+}
+
+func TestGenerateContent_NonStreamingNoChoicesRetried(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{
+		{resp: openai.ChatCompletionResponse{}},
+		{resp: textCompletion("Recovered", openai.FinishReasonStop)},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{MaxRetries: 2}}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(fake.requests))
+	}
+	if len(responses) != 1 || responses[0].Content.Parts[0].Text != "Recovered" {
+		t.Errorf("expected the retried response, got %+v", responses)
+	}
+}
+
+func TestGenerateContent_NonStreamingNoChoicesAfterRetries(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: openai.ChatCompletionResponse{}}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{MaxRetries: 2}}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if err == nil {
+		t.Fatal("expected error when every attempt has no choices")
+	}
+	if err.Error() != "openrouter returned no choices after 3 attempts" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	if len(fake.requests) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(fake.requests))
+	}
+}
+
+func TestGenerateContent_NonStreamingAPIErrorNotRetried(t *testing.T) {
+	apiErr := &openai.APIError{HTTPStatusCode: 400, Message: "bad request"}
+	fake := &fakeChatClient{completions: []fakeCompletion{{err: apiErr}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{MaxRetries: 2}}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if !errors.Is(err, apiErr) {
+		t.Errorf("expected wrapped API error, got %v", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(fake.requests))
+	}
+}
+
+func TestGenerateContent_NonStreamingAPIError(t *testing.T) {
+	apiErr := &openai.APIError{HTTPStatusCode: 500, Message: "upstream failure"}
+	fake := &fakeChatClient{completions: []fakeCompletion{{err: apiErr}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if !errors.Is(err, apiErr) {
+		t.Errorf("expected wrapped API error, got %v", err)
+	}
+}
+
+func TestGenerateContent_ShrinkOnOverflow(t *testing.T) {
+	overflow := &openai.APIError{HTTPStatusCode: 400, Message: "This endpoint's maximum context length is 8192 tokens."}
+	fake := &fakeChatClient{completions: []fakeCompletion{
+		{err: overflow},
+		{resp: textCompletion("Trimmed answer", openai.FinishReasonStop)},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{ShrinkOnOverflow: true}}
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			genai.NewContentFromText("An old question", genai.RoleUser),
+			genai.NewContentFromText("An old answer", genai.RoleModel),
+			genai.NewContentFromText("The latest question", genai.RoleUser),
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("You are a helpful assistant.", "system"),
+		},
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), req, false))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(responses) != 1 || responses[0].Content.Parts[0].Text != "Trimmed answer" {
+		t.Fatalf("expected the retried response, got %+v", responses)
+	}
+	if len(fake.requests) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(fake.requests))
+	}
+	retried := fake.requests[1].Messages
+	if len(retried) >= len(fake.requests[0].Messages) {
+		t.Errorf("expected the retry to send fewer messages, got %d then %d", len(fake.requests[0].Messages), len(retried))
+	}
+	if retried[0].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("expected system message to be kept, got %q", retried[0].Role)
+	}
+	if last := retried[len(retried)-1]; last.Content != "The latest question" {
+		t.Errorf("expected latest user turn to be kept, got %q", last.Content)
+	}
+}
+
+func TestGenerateContent_ContextLengthWithoutShrink(t *testing.T) {
+	overflow := &openai.APIError{HTTPStatusCode: 400, Message: "maximum context length is 8192 tokens"}
+	fake := &fakeChatClient{completions: []fakeCompletion{{err: overflow}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if !errors.Is(err, ErrContextLengthExceeded) {
+		t.Errorf("expected ErrContextLengthExceeded, got %v", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(fake.requests))
+	}
+}
+
+func TestGenerateContent_ShrinkOnOverflowNothingToTrim(t *testing.T) {
+	overflow := &openai.APIError{HTTPStatusCode: 400, Message: "maximum context length is 10 tokens"}
+	fake := &fakeChatClient{completions: []fakeCompletion{{err: overflow}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{ShrinkOnOverflow: true}}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("Only the latest turn"), false))
+
+	if !errors.Is(err, ErrContextLengthExceeded) {
+		t.Errorf("expected ErrContextLengthExceeded, got %v", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("expected no retry when nothing can be trimmed, got %d attempts", len(fake.requests))
+	}
+}
+
+// ============================================================================
+// Streaming Tests
+// ============================================================================
+
+func TestGenerateContent_Streaming(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Hello", ""),
+		textChunk(", world", ""),
+		textChunk("!", openai.FinishReasonStop),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(responses) != 4 {
+		t.Fatalf("expected 3 partial responses and 1 final, got %d", len(responses))
+	}
+	for i, resp := range responses[:3] {
+		if !resp.Partial {
+			t.Errorf("expected response %d to be partial", i)
+		}
+	}
+	final := responses[3]
+	if final.Partial || !final.TurnComplete {
+		t.Errorf("expected final response to be complete, got partial=%v turnComplete=%v", final.Partial, final.TurnComplete)
+	}
+	if final.Content.Parts[0].Text != "Hello, world!" {
+		t.Errorf("expected accumulated text 'Hello, world!', got %q", final.Content.Parts[0].Text)
+	}
+	if !fake.requests[0].Stream {
+		t.Error("expected streaming request")
+	}
+}
+
+func TestGenerateContent_StreamingUsageWithoutFinishReason(t *testing.T) {
+	last := textChunk("!", "")
+	last.Usage = &openai.Usage{PromptTokens: 4, CompletionTokens: 3, TotalTokens: 7}
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Hello", ""),
+		last,
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("expected 2 partial responses and 1 final, got %d", len(responses))
+	}
+	final := responses[2]
+	if final.Partial || !final.TurnComplete {
+		t.Errorf("expected final response to be complete, got partial=%v turnComplete=%v", final.Partial, final.TurnComplete)
+	}
+	if final.FinishReason != genai.FinishReasonStop {
+		t.Errorf("expected finish reason STOP, got %v", final.FinishReason)
+	}
+	if final.Content.Parts[0].Text != "Hello!" {
+		t.Errorf("expected accumulated text 'Hello!', got %q", final.Content.Parts[0].Text)
+	}
+	if final.UsageMetadata == nil || final.UsageMetadata.TotalTokenCount != 7 {
+		t.Errorf("expected usage on the final response, got %+v", final.UsageMetadata)
+	}
+}
+
+func TestGenerateContent_StreamingMidStreamUsage(t *testing.T) {
+	early := textChunk("Hello", "")
+	early.Usage = &openai.Usage{PromptTokens: 4, CompletionTokens: 1, TotalTokens: 5}
+	later := textChunk(", world", "")
+	later.Usage = &openai.Usage{PromptTokens: 4, CompletionTokens: 3, TotalTokens: 7}
+	partial := textChunk("!", "")
+	// A later chunk reporting only some counts doesn't lower the others
+	partial.Usage = &openai.Usage{CompletionTokens: 2}
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		early,
+		later,
+		partial,
+		textChunk("", openai.FinishReasonStop),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	final := responses[len(responses)-1]
+	if final.Partial {
+		t.Fatal("expected the last response to be final")
+	}
+	usage := final.UsageMetadata
+	if usage == nil {
+		t.Fatal("expected usage from the mid-stream chunks on the final response")
+	}
+	if usage.PromptTokenCount != 4 || usage.CandidatesTokenCount != 3 || usage.TotalTokenCount != 7 {
+		t.Errorf("expected the most complete counts 4/3/7, got %d/%d/%d",
+			usage.PromptTokenCount, usage.CandidatesTokenCount, usage.TotalTokenCount)
+	}
+}
+
+func TestGenerateContent_StreamingNoFinishReasonOrUsage(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{textChunk("Hello", "")}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, resp := range responses {
+		if !resp.Partial {
+			t.Errorf("expected no terminal response without a finish reason or usage, got %+v", resp)
+		}
+	}
+}
+
+func TestGenerateContent_StreamChunkMinChars(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Th", ""),
+		textChunk("e q", ""),
+		textChunk("uick", ""),
+		textChunk(" ", ""),
+		textChunk("brown fox", ""),
+		textChunk(" ju", ""),
+		textChunk("mps", openai.FinishReasonStop),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{StreamChunkMinChars: 8}}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var partials []string
+	for _, resp := range responses[:len(responses)-1] {
+		if !resp.Partial {
+			t.Fatalf("expected only the last response to be final, got %+v", resp)
+		}
+		partials = append(partials, resp.Content.Parts[0].Text)
+	}
+	want := []string{"The quick", " brown fox", " jumps"}
+	if strings.Join(partials, "|") != strings.Join(want, "|") {
+		t.Errorf("expected coalesced partials %q, got %q", want, partials)
+	}
+	final := responses[len(responses)-1]
+	if final.Partial || final.Content.Parts[0].Text != "The quick brown fox jumps" {
+		t.Errorf("expected the full text in the final response, got %+v", final)
+	}
+}
+
+func TestGenerateContent_StreamingRecvError(t *testing.T) {
+	streamErr := errors.New("connection reset")
+	fake := &fakeChatClient{
+		chunks:    []openai.ChatCompletionStreamResponse{textChunk("Hel", "")},
+		streamErr: streamErr,
+	}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if !errors.Is(err, streamErr) {
+		t.Errorf("expected wrapped stream error, got %v", err)
+	}
+	if len(responses) != 1 {
+		t.Errorf("expected 1 partial response before the error, got %d", len(responses))
+	}
+}
+
+func TestGenerateContent_StreamingToolCall(t *testing.T) {
+	idx := 0
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{{Index: &idx, ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":`}}},
+		}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{{Index: &idx, Function: openai.FunctionCall{Arguments: `"Paris"}`}}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}}},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Weather?"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("expected 1 final response, got %d", len(responses))
+	}
+	fc := responses[0].Content.Parts[0].FunctionCall
+	if fc == nil {
+		t.Fatal("expected function call part")
+	}
+	if fc.ID != "call_1" || fc.Name != "get_weather" || fc.Args["city"] != "Paris" {
+		t.Errorf("unexpected function call: %+v", fc)
+	}
+}
+
+func TestGenerateContent_StreamingTextWithToolCall(t *testing.T) {
+	idx := 0
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Let me ", ""),
+		textChunk("look that up", ""),
+		{Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{{Index: &idx, ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}}},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Weather?"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	final := responses[len(responses)-1]
+	if final.Partial {
+		t.Fatal("expected the last response to be final")
+	}
+	parts := final.Content.Parts
+	if len(parts) != 2 {
+		t.Fatalf("expected a text part and a function call part, got %d parts", len(parts))
+	}
+	if parts[0].Text != "Let me look that up" {
+		t.Errorf("expected text 'Let me look that up', got %q", parts[0].Text)
+	}
+	if fc := parts[1].FunctionCall; fc == nil || fc.ID != "call_1" || fc.Name != "get_weather" || fc.Args["city"] != "Paris" {
+		t.Errorf("unexpected function call: %+v", fc)
+	}
+}
+
+func TestGenerateContent_StreamingToolCallByID(t *testing.T) {
+	// No index on any fragment; the ID repeats on each one
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":`}}},
+		}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_time", Arguments: `{}`}}},
+		}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{{ID: "call_1", Function: openai.FunctionCall{Arguments: `"Paris"}`}}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}}},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Weather?"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parts := responses[len(responses)-1].Content.Parts
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 assembled tool calls, got %d parts", len(parts))
+	}
+	fc := parts[0].FunctionCall
+	if fc == nil || fc.ID != "call_1" || fc.Name != "get_weather" || fc.Args["city"] != "Paris" {
+		t.Errorf("unexpected first function call: %+v", fc)
+	}
+	if fc := parts[1].FunctionCall; fc == nil || fc.ID != "call_2" || fc.Name != "get_time" {
+		t.Errorf("unexpected second function call: %+v", fc)
+	}
+}
+
+func TestGenerateContent_StreamingToolCallNilIndex(t *testing.T) {
+	// A single call streamed without indices; only the first fragment has an ID
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather"}}},
+		}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{{Function: openai.FunctionCall{Arguments: `{"city":`}}},
+		}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{{Function: openai.FunctionCall{Arguments: `"Paris"}`}}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}}},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Weather?"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parts := responses[len(responses)-1].Content.Parts
+	if len(parts) != 1 {
+		t.Fatalf("expected 1 assembled tool call, got %d parts", len(parts))
+	}
+	fc := parts[0].FunctionCall
+	if fc == nil || fc.ID != "call_1" || fc.Name != "get_weather" || fc.Args["city"] != "Paris" {
+		t.Errorf("unexpected function call: %+v", fc)
+	}
+}
+
+func TestMergeToolCallDelta_NilIndexWithoutID(t *testing.T) {
+	var calls []openai.ToolCall
+	calls = mergeToolCallDelta(calls, openai.ToolCall{Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "ping", Arguments: `{"a":`}})
+	calls = mergeToolCallDelta(calls, openai.ToolCall{Function: openai.FunctionCall{Arguments: `1}`}})
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 tool call, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "ping" || calls[0].Function.Arguments != `{"a":1}` {
+		t.Errorf("unexpected merged tool call: %+v", calls[0])
+	}
+}
+
+func TestGenerateContent_StreamingTruncatedToolArguments(t *testing.T) {
+	first, second := 0, 1
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{
+				{Index: &first, ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_time", Arguments: `{}`}},
+				{Index: &second, ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":`}},
+			},
+		}}}},
+		// The stream is cut off before the second call's arguments complete
+		{Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        openai.ChatCompletionStreamChoiceDelta{},
+			FinishReason: openai.FinishReasonLength,
+		}}},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Weather and time?"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	final := responses[len(responses)-1]
+	if final.FinishReason != genai.FinishReasonMalformedFunctionCall {
+		t.Errorf("expected finish reason %q, got %q", genai.FinishReasonMalformedFunctionCall, final.FinishReason)
+	}
+	if !strings.Contains(final.ErrorMessage, "get_weather") {
+		t.Errorf("expected error message naming the incomplete call, got %q", final.ErrorMessage)
+	}
+	if len(final.Content.Parts) != 1 || final.Content.Parts[0].FunctionCall.Name != "get_time" {
+		t.Errorf("expected only the complete call to be emitted, got %+v", final.Content.Parts)
+	}
+}
+
+// reasoningChunk builds a stream chunk carrying a reasoning delta.
+func reasoningChunk(text string) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{ReasoningContent: text},
+		}},
+	}
+}
+
+func TestGenerateContent_StreamingReasoning(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		reasoningChunk("The user greets me. "),
+		reasoningChunk("I should greet back."),
+		textChunk("Hello", ""),
+		reasoningChunk(" Keep it short."),
+		textChunk("!", openai.FinishReasonStop),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "deepseek/deepseek-r1"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(responses) != 6 {
+		t.Fatalf("expected 5 partials and a final response, got %d", len(responses))
+	}
+	wantPartials := []struct {
+		text    string
+		thought bool
+	}{
+		{"The user greets me. ", true},
+		{"I should greet back.", true},
+		{"Hello", false},
+		{" Keep it short.", true},
+		{"!", false},
+	}
+	for i, want := range wantPartials {
+		part := responses[i].Content.Parts[0]
+		if !responses[i].Partial || part.Text != want.text || part.Thought != want.thought {
+			t.Errorf("partial %d: expected %q (thought=%v), got %q (thought=%v, partial=%v)",
+				i, want.text, want.thought, part.Text, part.Thought, responses[i].Partial)
+		}
+	}
+
+	final := responses[5]
+	if len(final.Content.Parts) != 2 {
+		t.Fatalf("expected thought and text parts, got %d", len(final.Content.Parts))
+	}
+	thought := final.Content.Parts[0]
+	if !thought.Thought || thought.Text != "The user greets me. I should greet back. Keep it short." {
+		t.Errorf("unexpected final thought part: %+v", thought)
+	}
+	if answer := final.Content.Parts[1]; answer.Thought || answer.Text != "Hello!" {
+		t.Errorf("unexpected final text part: %+v", answer)
+	}
+}
+
+func TestGenerateContent_StreamingCancelBetweenChunks(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("one", ""),
+		textChunk(" two", ""),
+		textChunk(" three", openai.FinishReasonStop),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var partials int
+	var gotErr error
+	for resp, err := range m.GenerateContent(ctx, userRequest("Count"), true) {
+		if err != nil {
+			gotErr = err
+			break
+		}
+		partials++
+		if resp.Partial {
+			cancel()
+		}
+	}
+
+	if !errors.Is(gotErr, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", gotErr)
+	}
+	if partials != 1 {
+		t.Errorf("expected iteration to stop after the first chunk, got %d responses", partials)
+	}
+}
+
+func TestGenerateContent_StreamingCancelWhileBlocked(t *testing.T) {
+	fake := &fakeChatClient{
+		chunks: []openai.ChatCompletionStreamResponse{textChunk("thinking", "")},
+		hang:   true,
+	}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := collect(m.GenerateContent(ctx, userRequest("Hi"), true))
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected ctx.Err() to be yielded as is, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected prompt termination, took %v", elapsed)
+	}
+}
+
+func TestGenerateContent_StreamingPartialOnCancel(t *testing.T) {
+	fake := &fakeChatClient{
+		chunks: []openai.ChatCompletionStreamResponse{textChunk("Once upon", ""), textChunk(" a time", "")},
+		hang:   true,
+	}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{PartialOnCancel: true}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	responses, err := collect(m.GenerateContent(ctx, userRequest("Tell a story"), true))
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the context error after the partial result, got %v", err)
+	}
+	final := responses[len(responses)-1]
+	if final.Partial || !final.TurnComplete {
+		t.Fatal("expected the partial result as a final response")
+	}
+	if final.ErrorCode != CancelledErrorCode {
+		t.Errorf("expected ErrorCode %q, got %q", CancelledErrorCode, final.ErrorCode)
+	}
+	if text := final.Content.Parts[0].Text; text != "Once upon a time" {
+		t.Errorf("expected the accumulated text, got %q", text)
+	}
+}
+
+func TestGenerateContent_StreamingCancelWithoutPartial(t *testing.T) {
+	fake := &fakeChatClient{
+		chunks: []openai.ChatCompletionStreamResponse{textChunk("Once upon", "")},
+		hang:   true,
+	}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	responses, err := collect(m.GenerateContent(ctx, userRequest("Tell a story"), true))
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	for _, resp := range responses {
+		if !resp.Partial {
+			t.Error("expected no final response without PartialOnCancel")
+		}
+	}
+}
+
+// ============================================================================
+// Concurrency Tests
+// ============================================================================
+
+// TestGenerateContent_ConcurrentStreams runs several streams on one model at
+// once; run with -race to check the per-call state is not shared.
+func TestGenerateContent_ConcurrentStreams(t *testing.T) {
+	server := newSSEServer(t, []string{
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"content":", "}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"content":"world"}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"id":"gen-1","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":4,"total_tokens":9}}`,
+	}, nil)
+	var usage usageRecorder
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithOnUsage(usage.record))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const workers = 8
+	errs := make(chan error, workers)
+	for range workers {
+		go func() {
+			var text string
+			var final *model.LLMResponse
+			for resp, err := range m.GenerateContent(context.Background(), userRequest("Hi"), true) {
+				if err != nil {
+					errs <- err
+					return
+				}
+				if resp.Partial {
+					text += resp.Content.Parts[0].Text
+				} else {
+					final = resp
+				}
+			}
+			switch {
+			case text != "Hello, world":
+				errs <- fmt.Errorf("unexpected streamed text %q", text)
+			case final == nil || len(final.Content.Parts) != 2 || final.Content.Parts[1].FunctionCall.Args["city"] != "Paris":
+				errs <- fmt.Errorf("unexpected final response %+v", final)
+			default:
+				errs <- nil
+			}
+		}()
+	}
+
+	for range workers {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if got := usage.count(); got != workers {
+		t.Errorf("expected %d usage reports, got %d", workers, got)
+	}
+}
+
+// ============================================================================
+// GenerateContentSync Tests
+// ============================================================================
+
+func TestGenerateContentSync_AggregatesStream(t *testing.T) {
+	idx := 0
+	usageChunk := openai.ChatCompletionStreamResponse{
+		Usage: &openai.Usage{PromptTokens: 7, CompletionTokens: 4, TotalTokens: 11},
+	}
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Let me ", ""),
+		textChunk("check.", ""),
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{{Index: &idx, ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":`}}},
+		}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{{Index: &idx, Function: openai.FunctionCall{Arguments: `"Paris"}`}}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}}},
+		usageChunk,
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	resp, err := m.GenerateContentSync(context.Background(), userRequest("Weather?"))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Partial || !resp.TurnComplete {
+		t.Errorf("expected a complete, non-partial response, got Partial=%v TurnComplete=%v", resp.Partial, resp.TurnComplete)
+	}
+	if len(resp.Content.Parts) != 2 {
+		t.Fatalf("expected text and function call parts, got %d", len(resp.Content.Parts))
+	}
+	if got := resp.Content.Parts[0].Text; got != "Let me check." {
+		t.Errorf("expected aggregated text %q, got %q", "Let me check.", got)
+	}
+	fc := resp.Content.Parts[1].FunctionCall
+	if fc == nil || fc.Name != "get_weather" || fc.Args["city"] != "Paris" {
+		t.Errorf("unexpected function call: %+v", fc)
+	}
+	if resp.FinishReason != genai.FinishReasonStop {
+		t.Errorf("expected finish reason %q, got %q", genai.FinishReasonStop, resp.FinishReason)
+	}
+	if resp.UsageMetadata == nil || resp.UsageMetadata.TotalTokenCount != 11 {
+		t.Errorf("expected usage with 11 total tokens, got %+v", resp.UsageMetadata)
+	}
+}
+
+func TestGenerateContentSync_StreamError(t *testing.T) {
+	fake := &fakeChatClient{
+		chunks:    []openai.ChatCompletionStreamResponse{textChunk("partial", "")},
+		streamErr: errors.New("connection reset"),
+	}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	resp, err := m.GenerateContentSync(context.Background(), userRequest("Hi"))
+
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if resp != nil {
+		t.Errorf("expected nil response on error, got %+v", resp)
+	}
+}
+
+func TestGenerateContentSync_NoFinalResponse(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{textChunk("cut off", "")}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	_, err := m.GenerateContentSync(context.Background(), userRequest("Hi"))
+
+	if err == nil {
+		t.Fatal("expected error when the stream ends without a finish reason")
+	}
+}
+
+// ============================================================================
+// OnUsage Tests
+// ============================================================================
+
+// usageRecorder collects OnUsage callback invocations.
+type usageRecorder struct {
+	mu     sync.Mutex
+	models []string
+	usages []genai.GenerateContentResponseUsageMetadata
+}
+
+func (r *usageRecorder) record(model string, usage genai.GenerateContentResponseUsageMetadata) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models = append(r.models, model)
+	r.usages = append(r.usages, usage)
+}
+
+func (r *usageRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.usages)
+}
+
+func TestOnUsage_NonStreaming(t *testing.T) {
+	resp := textCompletion("Hi!", openai.FinishReasonStop)
+	resp.Usage = openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	rec := &usageRecorder{}
+	m := &OpenRouterModel{
+		chat:      &fakeChatClient{completions: []fakeCompletion{{resp: resp}}},
+		modelName: "openai/gpt-4",
+		cfg:       OpenRouterConfig{OnUsage: rec.record},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rec.usages) != 1 {
+		t.Fatalf("expected OnUsage to fire once, got %d", len(rec.usages))
+	}
+	if rec.models[0] != "openai/gpt-4" {
+		t.Errorf("expected model 'openai/gpt-4', got %q", rec.models[0])
+	}
+	got := rec.usages[0]
+	if got.PromptTokenCount != 10 || got.CandidatesTokenCount != 5 || got.TotalTokenCount != 15 {
+		t.Errorf("unexpected usage: %+v", got)
+	}
+}
+
+func TestOnUsage_StreamingFiresOnceAtEnd(t *testing.T) {
+	usageChunk := openai.ChatCompletionStreamResponse{
+		Usage: &openai.Usage{PromptTokens: 20, CompletionTokens: 3, TotalTokens: 23},
+	}
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("One", ""),
+		textChunk(" two", ""),
+		textChunk(" three", openai.FinishReasonStop),
+		usageChunk,
+	}}
+	rec := &usageRecorder{}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{OnUsage: rec.record}}
+
+	var firedBeforeFinal int
+	for resp, err := range m.GenerateContent(context.Background(), userRequest("Count"), true) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Partial {
+			firedBeforeFinal = len(rec.usages)
+			continue
+		}
+		if resp.UsageMetadata == nil || resp.UsageMetadata.TotalTokenCount != 23 {
+			t.Errorf("expected final response to carry usage, got %+v", resp.UsageMetadata)
+		}
+	}
+
+	if firedBeforeFinal != 0 {
+		t.Errorf("expected OnUsage not to fire for partial responses, fired %d times", firedBeforeFinal)
+	}
+	if len(rec.usages) != 1 {
+		t.Fatalf("expected OnUsage to fire once, got %d", len(rec.usages))
+	}
+	if rec.usages[0].PromptTokenCount != 20 || rec.usages[0].CandidatesTokenCount != 3 {
+		t.Errorf("unexpected usage: %+v", rec.usages[0])
+	}
+	if opts := fake.requests[0].StreamOptions; opts == nil || !opts.IncludeUsage {
+		t.Error("expected streaming request to ask for usage")
+	}
+}
+
+func TestOnUsage_NoUsageReported(t *testing.T) {
+	rec := &usageRecorder{}
+	m := &OpenRouterModel{
+		chat:      &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("Hi!", openai.FinishReasonStop)}}},
+		modelName: "openai/gpt-4",
+		cfg:       OpenRouterConfig{OnUsage: rec.record},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rec.usages) != 0 {
+		t.Errorf("expected OnUsage not to fire without usage, got %d calls", len(rec.usages))
+	}
+}
+
+// ============================================================================
+// Truncation Detection Tests
+// ============================================================================
+
+func TestIsTruncated(t *testing.T) {
+	tests := []struct {
+		name   string
+		finish openai.FinishReason
+		want   bool
+	}{
+		{"length", openai.FinishReasonLength, true},
+		{"stop", openai.FinishReasonStop, false},
+		{"tool calls", openai.FinishReasonToolCalls, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("partial", tt.finish)}}}
+			m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+			responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := IsTruncated(responses[0]); got != tt.want {
+				t.Errorf("IsTruncated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTruncated_Streaming(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Once upon", ""),
+		textChunk(" a time", openai.FinishReasonLength),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Tell a story"), true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, resp := range responses[:len(responses)-1] {
+		if IsTruncated(resp) {
+			t.Error("expected partial responses not to be reported as truncated")
+		}
+	}
+	if !IsTruncated(responses[len(responses)-1]) {
+		t.Error("expected the final response to be reported as truncated")
+	}
+}
+
+func TestIsTruncated_Nil(t *testing.T) {
+	if IsTruncated(nil) {
+		t.Error("expected a nil response not to be truncated")
+	}
+}
+
+// ============================================================================
+// Continue Tests
+// ============================================================================
+
+func TestContinue_StitchesOutput(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{
+		{resp: textCompletion("The quick brown", openai.FinishReasonLength)},
+		{resp: textCompletion(" fox jumps.", openai.FinishReasonStop)},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+	temperature := float32(0.3)
+	req := userRequest("Write a sentence")
+	req.Config = &genai.GenerateContentConfig{
+		Temperature:     &temperature,
+		MaxOutputTokens: 3,
+		Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{
+			{Name: "lookup", Description: "Look something up"},
+		}}},
+	}
+
+	first, err := collect(m.GenerateContent(context.Background(), req, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsTruncated(first[0]) {
+		t.Fatal("expected the first response to be truncated")
+	}
+
+	responses, err := collect(m.Continue(context.Background(), req, first[0], false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	final := responses[len(responses)-1]
+	if got := final.Content.Parts[0].Text; got != "The quick brown fox jumps." {
+		t.Errorf("expected stitched output, got %q", got)
+	}
+	if IsTruncated(final) {
+		t.Error("expected the continuation to finish normally")
+	}
+
+	cont := fake.requests[1]
+	if len(cont.Messages) != 2 {
+		t.Fatalf("expected user and partial assistant messages, got %d", len(cont.Messages))
+	}
+	last := cont.Messages[1]
+	if last.Role != openai.ChatMessageRoleAssistant || last.Content != "The quick brown" {
+		t.Errorf("expected partial assistant output last, got %+v", last)
+	}
+	if cont.Temperature != 0.3 || cont.MaxCompletionTokens != 3 {
+		t.Errorf("expected generation config to carry over, got temperature=%v max=%d", cont.Temperature, cont.MaxCompletionTokens)
+	}
+	if len(cont.Tools) != 1 || cont.Tools[0].Function.Name != "lookup" {
+		t.Errorf("expected tools to carry over, got %+v", cont.Tools)
+	}
+	if len(req.Contents) != 1 {
+		t.Errorf("expected the previous request to be left unchanged, got %d contents", len(req.Contents))
+	}
+}
+
+func TestContinue_Streaming(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk(" world", ""),
+		textChunk("!", openai.FinishReasonStop),
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4"}
+	prev := &model.LLMResponse{
+		Content:      genai.NewContentFromText("Hello", genai.RoleModel),
+		FinishReason: genai.FinishReasonMaxTokens,
+	}
+
+	responses, err := collect(m.Continue(context.Background(), userRequest("Greet"), prev, true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if responses[0].Content.Parts[0].Text != " world" {
+		t.Errorf("expected partial responses to carry only new text, got %q", responses[0].Content.Parts[0].Text)
+	}
+	final := responses[len(responses)-1]
+	if got := final.Content.Parts[0].Text; got != "Hello world!" {
+		t.Errorf("expected stitched output, got %q", got)
+	}
+}
+
+func TestContinue_NoPreviousText(t *testing.T) {
+	m := &OpenRouterModel{chat: &fakeChatClient{}, modelName: "openai/gpt-4"}
+	prev := &model.LLMResponse{Content: &genai.Content{Role: genai.RoleModel}}
+
+	_, err := collect(m.Continue(context.Background(), userRequest("Hi"), prev, false))
+
+	if err == nil || !strings.Contains(err.Error(), "no text to continue") {
+		t.Errorf("expected a missing-text error, got %v", err)
+	}
+}
+
+// ============================================================================
+// Model Override Tests
+// ============================================================================
+
+func TestContextWithModel_OverridesRequestModel(t *testing.T) {
+	resp := textCompletion("Hi!", openai.FinishReasonStop)
+	resp.Usage = openai.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4}
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: resp}}}
+	rec := &usageRecorder{}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{OnUsage: rec.record}}
+
+	ctx := ContextWithModel(context.Background(), "anthropic/claude-3-haiku")
+	if _, err := collect(m.GenerateContent(ctx, userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := fake.requests[0].Model; got != "anthropic/claude-3-haiku" {
+		t.Errorf("expected overridden model in request, got %q", got)
+	}
+	if got := fake.requests[1].Model; got != "openai/gpt-4" {
+		t.Errorf("expected configured model without an override, got %q", got)
+	}
+	if rec.models[0] != "anthropic/claude-3-haiku" {
+		t.Errorf("expected OnUsage to report the overridden model, got %q", rec.models[0])
+	}
+	if m.Name() != "openai/gpt-4" {
+		t.Errorf("expected Name to be unaffected, got %q", m.Name())
+	}
+}
+
+func TestContextWithPrediction(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("func run() {}", openai.FinishReasonStop)}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4o"}
+
+	ctx := ContextWithPrediction(context.Background(), "func main() {}")
+	if _, err := collect(m.GenerateContent(ctx, userRequest("Rename main to run"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hello!"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := json.Marshal(fake.requests[0])
+	want := `"prediction":{"content":"func main() {}","type":"content"}`
+	if !bytes.Contains(data, []byte(want)) {
+		t.Errorf("expected %s in request body, got %s", want, data)
+	}
+	if fake.requests[1].Prediction != nil {
+		t.Errorf("expected no prediction on a call without one, got %+v", fake.requests[1].Prediction)
+	}
+}
+
+// ============================================================================
+// Hook Tests
+// ============================================================================
+
+func TestBeforeRequest_ModifiesOutgoingRequest(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{textChunk("Hi!", openai.FinishReasonStop)}}
+	var sawStream bool
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		BeforeRequest: func(req *openai.ChatCompletionRequest) {
+			sawStream = req.Stream
+			req.Model = "anthropic/claude-3-haiku"
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "Be brief."})
+		},
+	}}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent := fake.requests[0]
+	if sent.Model != "anthropic/claude-3-haiku" {
+		t.Errorf("expected the hook's model in the request, got %q", sent.Model)
+	}
+	if len(sent.Messages) != 2 || sent.Messages[1].Content != "Be brief." {
+		t.Errorf("expected the hook's message in the request, got %+v", sent.Messages)
+	}
+	if sawStream {
+		t.Error("expected the hook to run before the stream flag is set")
+	}
+	if !sent.Stream {
+		t.Error("expected the streaming request to still stream")
+	}
+}
+
+func TestAfterResponse_SeesPartialAndFinal(t *testing.T) {
+	fake := &fakeChatClient{chunks: []openai.ChatCompletionStreamResponse{
+		textChunk("Hello", ""),
+		textChunk(" secret", openai.FinishReasonStop),
+	}}
+	var partials, finals int
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		AfterResponse: func(resp *model.LLMResponse) {
+			if resp.Partial {
+				partials++
+			} else {
+				finals++
+			}
+			for _, part := range resp.Content.Parts {
+				part.Text = strings.ReplaceAll(part.Text, "secret", "[redacted]")
+			}
+		},
+	}}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if partials != 2 || finals != 1 {
+		t.Errorf("expected the hook to see 2 partial and 1 final response, got %d and %d", partials, finals)
+	}
+	if text := responses[len(responses)-1].Content.Parts[0].Text; text != "Hello [redacted]" {
+		t.Errorf("expected the hook's changes to reach the caller, got %q", text)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CreditInfo is the credit balance of the OpenRouter account.
+type CreditInfo struct {
+	// Total is the total credits purchased.
+	Total float64
+	// Used is the credits spent so far.
+	Used float64
+	// Remaining is Total minus Used.
+	Remaining float64
+}
+
+// Credits fetches the account's credit balance, e.g. for a dashboard.
+func (m *OpenRouterModel) Credits(ctx context.Context) (CreditInfo, error) {
+	resp, err := m.apiGet(ctx, "/credits")
+	if err != nil {
+		return CreditInfo{}, fmt.Errorf("openrouter credits: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return CreditInfo{}, fmt.Errorf("openrouter credits: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return CreditInfo{}, fmt.Errorf("openrouter credits: %w (status %d)", ErrUnauthorized, resp.StatusCode)
+	default:
+		return CreditInfo{}, fmt.Errorf("openrouter credits: unexpected status %d: %s", resp.StatusCode, data)
+	}
+
+	var body struct {
+		Data struct {
+			TotalCredits float64 `json:"total_credits"`
+			TotalUsage   float64 `json:"total_usage"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return CreditInfo{}, fmt.Errorf("openrouter credits: failed to decode response: %w", err)
+	}
+	return CreditInfo{
+		Total:     body.Data.TotalCredits,
+		Used:      body.Data.TotalUsage,
+		Remaining: body.Data.TotalCredits - body.Data.TotalUsage,
+	}, nil
+}
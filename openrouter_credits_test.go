@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newCreditsServer starts an httptest server answering /credits with a
+// sample balance.
+func newCreditsServer(t *testing.T, record func(*http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if record != nil {
+			record(r)
+		}
+		switch {
+		case r.Header.Get("Authorization") != "Bearer test-api-key":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path != "/credits":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"data":{"total_credits":100.5,"total_usage":25.25}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCredits(t *testing.T) {
+	var got *http.Request
+	server := newCreditsServer(t, func(r *http.Request) { got = r })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	credits, err := m.Credits(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Method != http.MethodGet {
+		t.Errorf("expected GET, got %s", got.Method)
+	}
+	want := CreditInfo{Total: 100.5, Used: 25.25, Remaining: 75.25}
+	if credits != want {
+		t.Errorf("expected %+v, got %+v", want, credits)
+	}
+}
+
+func TestCredits_Unauthorized(t *testing.T) {
+	server := newCreditsServer(t, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("wrong-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = m.Credits(context.Background())
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestCredits_Unreachable(t *testing.T) {
+	server := newCreditsServer(t, nil)
+	server.Close()
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = m.Credits(context.Background())
+
+	if !errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected ErrUnreachable, got %v", err)
+	}
+}
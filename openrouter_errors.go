@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrContextLengthExceeded is matched (via errors.Is) by errors for requests
+// whose prompt does not fit the model's context window.
+var ErrContextLengthExceeded = errors.New("context length exceeded")
+
+// ErrUnauthorized is matched (via errors.Is) by Ping, GetGeneration and
+// Credits errors when OpenRouter rejects the API key.
+var ErrUnauthorized = errors.New("openrouter: unauthorized")
+
+// ErrUnreachable is matched (via errors.Is) by Ping, GetGeneration and
+// Credits errors when OpenRouter could not be reached, e.g. on a DNS failure,
+// refused connection or timeout.
+var ErrUnreachable = errors.New("openrouter: unreachable")
+
+// ErrRequestTooLarge is matched (via errors.Is) by errors for requests that
+// exceed the configured MaxMessages or MaxRequestBytes.
+var ErrRequestTooLarge = errors.New("openrouter: request too large")
+
+// contextLengthPhrases are fragments of the messages providers use to reject
+// prompts that are too long. They are only matched on 400 and 413 responses,
+// as rate-limit messages such as "too many tokens per minute" use some of them.
+var contextLengthPhrases = []string{
+	"context length",
+	"context_length_exceeded",
+	"context window",
+	"maximum context",
+	"too many tokens",
+	"prompt is too long",
+}
+
+// contextLimitPattern extracts the context size from messages such as
+// "This endpoint's maximum context length is 8192 tokens".
+var contextLimitPattern = regexp.MustCompile(`(?i)maximum context length is (\d+)`)
+
+// ProviderError is returned when OpenRouter reports which upstream provider
+// failed a call. It carries the provider name and the provider's raw error,
+// and unwraps to the underlying go-openai error.
+type ProviderError struct {
+	// Provider is the name of the upstream provider, e.g. "Together".
+	Provider string
+	// Raw is the upstream provider's error message as OpenRouter relayed it.
+	Raw string
+	// Err is the wrapped API error.
+	Err error
+}
+
+func (e *ProviderError) Error() string {
+	var details []string
+	if e.Provider != "" {
+		details = append(details, "provider: "+e.Provider)
+	}
+	if e.Raw != "" {
+		details = append(details, "raw: "+e.Raw)
+	}
+	if len(details) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (%s)", e.Err, strings.Join(details, ", "))
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// isContextLengthError reports whether err is an API error rejecting a
+// prompt for exceeding the context window.
+func isContextLengthError(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.HTTPStatusCode != http.StatusBadRequest && apiErr.HTTPStatusCode != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	if code, ok := apiErr.Code.(string); ok && code == "context_length_exceeded" {
+		return true
+	}
+	message := strings.ToLower(apiErr.Message)
+	for _, phrase := range contextLengthPhrases {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextLimit returns the context size stated in a context-length error
+// message, if there is one.
+func contextLimit(err error) (int, bool) {
+	match := contextLimitPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, false
+	}
+	limit, convErr := strconv.Atoi(match[1])
+	if convErr != nil {
+		return 0, false
+	}
+	return limit, true
+}
+
+// callError wraps err with msg and, when the error response carried
+// upstream provider metadata, returns it as a *ProviderError. Context-length
+// errors also match ErrContextLengthExceeded.
+func callError(ctx context.Context, msg string, err error) error {
+	if isContextLengthError(err) {
+		err = fmt.Errorf("%s: %w: %w", msg, ErrContextLengthExceeded, err)
+	} else {
+		err = fmt.Errorf("%s: %w", msg, err)
+	}
+	state := callStateFrom(ctx)
+	if state == nil || state.providerErr == nil {
+		return err
+	}
+	return &ProviderError{
+		Provider: state.providerErr.Provider,
+		Raw:      state.providerErr.Raw,
+		Err:      err,
+	}
+}
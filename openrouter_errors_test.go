@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newErrorServer starts an httptest server that replies to every request
+// with status and body.
+func newErrorServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// ============================================================================
+// ProviderError Tests
+// ============================================================================
+
+func TestProviderError_FromErrorMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool
+	}{
+		{name: "non-streaming", stream: false},
+		{name: "streaming", stream: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newErrorServer(t, http.StatusBadGateway,
+				`{"error":{"code":502,"message":"Provider returned error","metadata":{"provider_name":"Together","raw":"model is overloaded"}}}`)
+			m, err := NewOpenRouterModel("meta-llama/llama-3-70b", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, err = collect(m.GenerateContent(context.Background(), userRequest("Hi"), tt.stream))
+
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("expected *ProviderError, got %T: %v", err, err)
+			}
+			if providerErr.Provider != "Together" {
+				t.Errorf("expected provider Together, got %q", providerErr.Provider)
+			}
+			if providerErr.Raw != "model is overloaded" {
+				t.Errorf("expected raw reason, got %q", providerErr.Raw)
+			}
+			if !strings.Contains(err.Error(), "provider: Together") || !strings.Contains(err.Error(), "raw: model is overloaded") {
+				t.Errorf("expected provider details in error message, got %q", err.Error())
+			}
+			var apiErr *openai.APIError
+			if !errors.As(err, &apiErr) {
+				t.Errorf("expected wrapped *openai.APIError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProviderError_RawObject(t *testing.T) {
+	server := newErrorServer(t, http.StatusBadRequest,
+		`{"error":{"code":400,"message":"Provider returned error","metadata":{"provider_name":"Fireworks","raw":{"error": "bad   input"}}}}`)
+	m, err := NewOpenRouterModel("meta-llama/llama-3-70b", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		t.Fatalf("expected *ProviderError, got %T: %v", err, err)
+	}
+	if providerErr.Raw != `{"error":"bad   input"}` {
+		t.Errorf("expected compact raw JSON, got %q", providerErr.Raw)
+	}
+}
+
+func TestProviderError_NoMetadata(t *testing.T) {
+	server := newErrorServer(t, http.StatusUnauthorized, `{"error":{"code":401,"message":"No auth credentials found"}}`)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		t.Errorf("expected a plain error without provider metadata, got %v", err)
+	}
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusUnauthorized {
+		t.Errorf("expected wrapped 401 *openai.APIError, got %v", err)
+	}
+}
+
+func TestProviderError_NotCarriedAcrossRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"error":{"code":502,"message":"Provider returned error","metadata":{"provider_name":"Together","raw":"model is overloaded"}}}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"code":401,"message":"No auth credentials found"}}`))
+	}))
+	t.Cleanup(server.Close)
+	retryOnce := retryerFunc(func(attempt int, err error) (time.Duration, bool) { return 0, attempt == 1 })
+	m, err := NewOpenRouterModel("meta-llama/llama-3-70b", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithRetryer(retryOnce))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		t.Errorf("expected the final error without the first attempt's provider details, got %v", err)
+	}
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusUnauthorized {
+		t.Errorf("expected wrapped 401 *openai.APIError, got %v", err)
+	}
+}
+
+func TestProviderError_Message(t *testing.T) {
+	base := errors.New("openrouter error: upstream failed")
+	tests := []struct {
+		name string
+		err  *ProviderError
+		want string
+	}{
+		{
+			name: "provider and raw",
+			err:  &ProviderError{Provider: "Together", Raw: "overloaded", Err: base},
+			want: "openrouter error: upstream failed (provider: Together, raw: overloaded)",
+		},
+		{
+			name: "provider only",
+			err:  &ProviderError{Provider: "Together", Err: base},
+			want: "openrouter error: upstream failed (provider: Together)",
+		},
+		{
+			name: "no details",
+			err:  &ProviderError{Err: base},
+			want: "openrouter error: upstream failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Context Length Tests
+// ============================================================================
+
+func TestIsContextLengthError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "maximum context length message",
+			err:  &openai.APIError{HTTPStatusCode: 400, Message: "This endpoint's maximum context length is 8192 tokens. However, you requested about 9000 tokens."},
+			want: true,
+		},
+		{
+			name: "context_length_exceeded code",
+			err:  &openai.APIError{HTTPStatusCode: 400, Code: "context_length_exceeded", Message: "Input too long"},
+			want: true,
+		},
+		{
+			name: "prompt is too long",
+			err:  &openai.APIError{HTTPStatusCode: 400, Message: "prompt is too long: 210000 tokens > 200000 maximum"},
+			want: true,
+		},
+		{
+			name: "payload too large",
+			err:  &openai.APIError{HTTPStatusCode: 413, Message: "Too many tokens in request"},
+			want: true,
+		},
+		{
+			name: "token rate limit",
+			err:  &openai.APIError{HTTPStatusCode: 429, Message: "Rate limit reached: too many tokens per minute"},
+			want: false,
+		},
+		{
+			name: "unrelated API error",
+			err:  &openai.APIError{HTTPStatusCode: 400, Message: "Invalid model"},
+			want: false,
+		},
+		{
+			name: "not an API error",
+			err:  errors.New("maximum context length is 8192 tokens"),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isContextLengthError(tt.err); got != tt.want {
+				t.Errorf("isContextLengthError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallError_ContextLength(t *testing.T) {
+	apiErr := &openai.APIError{HTTPStatusCode: 400, Message: "maximum context length is 4096 tokens"}
+
+	err := callError(context.Background(), "openrouter error", apiErr)
+
+	if !errors.Is(err, ErrContextLengthExceeded) {
+		t.Errorf("expected ErrContextLengthExceeded, got %v", err)
+	}
+	if !errors.Is(err, apiErr) {
+		t.Errorf("expected the API error to stay wrapped, got %v", err)
+	}
+	if limit, ok := contextLimit(err); !ok || limit != 4096 {
+		t.Errorf("expected context limit 4096, got %d (ok=%v)", limit, ok)
+	}
+}
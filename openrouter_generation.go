@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrGenerationNotFound is matched (via errors.Is) by GetGeneration errors
+// when OpenRouter has no record of the ID. Stats can take a few seconds to
+// become available after a call finishes, so a lookup may be retried.
+var ErrGenerationNotFound = errors.New("openrouter: generation not found")
+
+// GenerationStats is OpenRouter's authoritative record of a generation,
+// including its final cost and the token counts it was billed for.
+type GenerationStats struct {
+	// ID is the generation ID.
+	ID string
+	// Model is the model that served the generation.
+	Model string
+	// ProviderName is the upstream provider, e.g. "OpenAI".
+	ProviderName string
+	// CreatedAt is when the generation was created.
+	CreatedAt time.Time
+	// TotalCost is the billed cost in credits.
+	TotalCost float64
+	// PromptTokens and CompletionTokens are counted with OpenRouter's
+	// normalized tokenizer.
+	PromptTokens     int
+	CompletionTokens int
+	// NativePromptTokens, NativeCompletionTokens and NativeReasoningTokens
+	// are counted with the model's own tokenizer, which billing uses.
+	NativePromptTokens     int
+	NativeCompletionTokens int
+	NativeReasoningTokens  int
+	// FinishReason is the normalized finish reason.
+	FinishReason string
+	// Latency is the time to the first token.
+	Latency time.Duration
+	// GenerationTime is the total generation time.
+	GenerationTime time.Duration
+	// Streamed reports whether the generation was streamed.
+	Streamed bool
+	// Cancelled reports whether the generation was cancelled.
+	Cancelled bool
+}
+
+// generationPayload is the data object of a /generation response.
+type generationPayload struct {
+	ID                     string    `json:"id"`
+	Model                  string    `json:"model"`
+	ProviderName           string    `json:"provider_name"`
+	CreatedAt              time.Time `json:"created_at"`
+	TotalCost              float64   `json:"total_cost"`
+	TokensPrompt           int       `json:"tokens_prompt"`
+	TokensCompletion       int       `json:"tokens_completion"`
+	NativeTokensPrompt     int       `json:"native_tokens_prompt"`
+	NativeTokensCompletion int       `json:"native_tokens_completion"`
+	NativeTokensReasoning  int       `json:"native_tokens_reasoning"`
+	FinishReason           string    `json:"finish_reason"`
+	Latency                float64   `json:"latency"`
+	GenerationTime         float64   `json:"generation_time"`
+	Streamed               bool      `json:"streamed"`
+	Cancelled              bool      `json:"cancelled"`
+}
+
+// GetGeneration fetches the stats OpenRouter recorded for a generation, such
+// as one returned by ResponseGenerationID. Use it to reconcile billing: its
+// cost and token counts are final, unlike those reported with a response.
+func (m *OpenRouterModel) GetGeneration(ctx context.Context, id string) (GenerationStats, error) {
+	if id == "" {
+		return GenerationStats{}, errors.New("openrouter generation: id is required")
+	}
+	resp, err := m.apiGet(ctx, "/generation?id="+url.QueryEscape(id))
+	if err != nil {
+		return GenerationStats{}, fmt.Errorf("openrouter generation: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GenerationStats{}, fmt.Errorf("openrouter generation: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return GenerationStats{}, fmt.Errorf("openrouter generation: %w (status %d)", ErrUnauthorized, resp.StatusCode)
+	case http.StatusNotFound:
+		return GenerationStats{}, fmt.Errorf("openrouter generation %q: %w", id, ErrGenerationNotFound)
+	default:
+		return GenerationStats{}, fmt.Errorf("openrouter generation: unexpected status %d: %s", resp.StatusCode, data)
+	}
+
+	var body struct {
+		Data *generationPayload `json:"data"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return GenerationStats{}, fmt.Errorf("openrouter generation: failed to decode response: %w", err)
+	}
+	if body.Data == nil {
+		return GenerationStats{}, fmt.Errorf("openrouter generation %q: %w", id, ErrGenerationNotFound)
+	}
+
+	g := body.Data
+	return GenerationStats{
+		ID:                     g.ID,
+		Model:                  g.Model,
+		ProviderName:           g.ProviderName,
+		CreatedAt:              g.CreatedAt,
+		TotalCost:              g.TotalCost,
+		PromptTokens:           g.TokensPrompt,
+		CompletionTokens:       g.TokensCompletion,
+		NativePromptTokens:     g.NativeTokensPrompt,
+		NativeCompletionTokens: g.NativeTokensCompletion,
+		NativeReasoningTokens:  g.NativeTokensReasoning,
+		FinishReason:           g.FinishReason,
+		Latency:                milliseconds(g.Latency),
+		GenerationTime:         milliseconds(g.GenerationTime),
+		Streamed:               g.Streamed,
+		Cancelled:              g.Cancelled,
+	}, nil
+}
+
+// milliseconds converts a duration in milliseconds to a time.Duration.
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
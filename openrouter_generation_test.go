@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const sampleGeneration = `{"data":{
+	"id":"gen-123","model":"openai/gpt-4","provider_name":"OpenAI","created_at":"2025-06-01T12:00:00Z",
+	"total_cost":0.0021,"tokens_prompt":120,"tokens_completion":45,
+	"native_tokens_prompt":118,"native_tokens_completion":47,"native_tokens_reasoning":12,
+	"finish_reason":"stop","latency":350,"generation_time":1200.5,"streamed":true,"cancelled":false,
+	"upstream_id":"chatcmpl-abc"}}`
+
+// newGenerationServer starts an httptest server answering /generation
+// lookups for a single known ID with sampleGeneration.
+func newGenerationServer(t *testing.T, record func(*http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if record != nil {
+			record(r)
+		}
+		switch {
+		case r.Header.Get("Authorization") != "Bearer test-api-key":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path != "/generation" || r.URL.Query().Get("id") != "gen-123":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"Generation not found","code":404}}`)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, sampleGeneration)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetGeneration(t *testing.T) {
+	var got *http.Request
+	server := newGenerationServer(t, func(r *http.Request) { got = r })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stats, err := m.GetGeneration(context.Background(), "gen-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Method != http.MethodGet {
+		t.Errorf("expected GET, got %s", got.Method)
+	}
+	want := GenerationStats{
+		ID:                     "gen-123",
+		Model:                  "openai/gpt-4",
+		ProviderName:           "OpenAI",
+		CreatedAt:              time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		TotalCost:              0.0021,
+		PromptTokens:           120,
+		CompletionTokens:       45,
+		NativePromptTokens:     118,
+		NativeCompletionTokens: 47,
+		NativeReasoningTokens:  12,
+		FinishReason:           "stop",
+		Latency:                350 * time.Millisecond,
+		GenerationTime:         1200500 * time.Microsecond,
+		Streamed:               true,
+	}
+	if !stats.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("expected CreatedAt %v, got %v", want.CreatedAt, stats.CreatedAt)
+	}
+	stats.CreatedAt = want.CreatedAt
+	if stats != want {
+		t.Errorf("unexpected stats\n got: %+v\nwant: %+v", stats, want)
+	}
+}
+
+func TestGetGeneration_NotFound(t *testing.T) {
+	server := newGenerationServer(t, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = m.GetGeneration(context.Background(), "gen-missing")
+
+	if !errors.Is(err, ErrGenerationNotFound) {
+		t.Errorf("expected ErrGenerationNotFound, got %v", err)
+	}
+}
+
+func TestGetGeneration_Unauthorized(t *testing.T) {
+	server := newGenerationServer(t, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("wrong-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = m.GetGeneration(context.Background(), "gen-123")
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestGetGeneration_EmptyID(t *testing.T) {
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := m.GetGeneration(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty ID")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// redactedAPIKey replaces the API key wherever it would appear in log output.
+const redactedAPIKey = "[REDACTED]"
+
+// logEnabled reports whether debug logging is configured and enabled.
+func (m *OpenRouterModel) logEnabled(ctx context.Context) bool {
+	return m.cfg.Logger != nil && m.cfg.Logger.Enabled(ctx, slog.LevelDebug)
+}
+
+// logJSON logs v as JSON under key at debug level.
+func (m *OpenRouterModel) logJSON(ctx context.Context, msg, key string, v any) {
+	if !m.logEnabled(ctx) {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		m.cfg.Logger.DebugContext(ctx, msg, slog.String("marshal_error", err.Error()))
+		return
+	}
+	m.cfg.Logger.DebugContext(ctx, msg, slog.String(key, m.redact(string(data))))
+}
+
+// logCompletion logs the finish reason and token usage of a completed turn.
+func (m *OpenRouterModel) logCompletion(ctx context.Context, finishReason openai.FinishReason, usage openai.Usage) {
+	if !m.logEnabled(ctx) {
+		return
+	}
+	m.cfg.Logger.DebugContext(ctx, "openrouter completion",
+		slog.String("model", m.requestModel(ctx)),
+		slog.String("finish_reason", string(finishReason)),
+		slog.Int("prompt_tokens", usage.PromptTokens),
+		slog.Int("completion_tokens", usage.CompletionTokens),
+		slog.Int("total_tokens", usage.TotalTokens),
+	)
+}
+
+// logWarn logs msg at warning level when a logger is configured.
+func (m *OpenRouterModel) logWarn(msg string, attrs ...slog.Attr) {
+	if m.cfg.Logger == nil {
+		return
+	}
+	m.cfg.Logger.LogAttrs(context.Background(), slog.LevelWarn, msg, attrs...)
+}
+
+// redact removes the configured API key from s.
+func (m *OpenRouterModel) redact(s string) string {
+	if m.cfg.APIKey == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, m.cfg.APIKey, redactedAPIKey)
+}
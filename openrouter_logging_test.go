@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ============================================================================
+// Logging Tests
+// ============================================================================
+
+func TestLogging_NonStreaming(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	resp := textCompletion("The answer is sk-or-secret", openai.FinishReasonStop)
+	resp.Usage = openai.Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16}
+	m := &OpenRouterModel{
+		chat:      &fakeChatClient{completions: []fakeCompletion{{resp: resp}}},
+		modelName: "openai/gpt-4",
+		cfg:       OpenRouterConfig{APIKey: "sk-or-secret", Logger: logger},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("What is 2+2?"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`msg="openrouter request"`,
+		`What is 2+2?`,
+		`msg="openrouter response"`,
+		`msg="openrouter completion"`,
+		`finish_reason=stop`,
+		`prompt_tokens=12`,
+		`completion_tokens=4`,
+		`total_tokens=16`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "sk-or-secret") {
+		t.Errorf("expected API key to be redacted, got:\n%s", out)
+	}
+	if !strings.Contains(out, redactedAPIKey) {
+		t.Errorf("expected redaction marker in log output, got:\n%s", out)
+	}
+}
+
+func TestLogging_DisabledAboveDebug(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	m := &OpenRouterModel{
+		chat:      &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("hi", openai.FinishReasonStop)}}},
+		modelName: "openai/gpt-4",
+		cfg:       OpenRouterConfig{Logger: logger},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no output at info level, got:\n%s", buf.String())
+	}
+}
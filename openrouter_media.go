@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/genai"
+)
+
+// chatMessagePartTypeInputAudio tags an audio content part. go-openai cannot
+// encode input_audio parts, so the part's Text carries the JSON input_audio
+// object and openRouterTransport expands it before the request is sent.
+const chatMessagePartTypeInputAudio openai.ChatMessagePartType = "input_audio"
+
+// audioFormats maps audio MIME types to OpenAI input_audio format names.
+var audioFormats = map[string]string{
+	"audio/wav":   "wav",
+	"audio/wave":  "wav",
+	"audio/x-wav": "wav",
+	"audio/mpeg":  "mp3",
+	"audio/mp3":   "mp3",
+	"audio/flac":  "flac",
+	"audio/ogg":   "ogg",
+	"audio/webm":  "webm",
+	"audio/aac":   "aac",
+	"audio/mp4":   "m4a",
+	"audio/x-m4a": "m4a",
+	"audio/aiff":  "aiff",
+}
+
+// audioMIMETypes maps audio output formats to MIME types.
+var audioMIMETypes = map[string]string{
+	"wav":   "audio/wav",
+	"mp3":   "audio/mpeg",
+	"flac":  "audio/flac",
+	"opus":  "audio/ogg",
+	"aac":   "audio/aac",
+	"pcm16": "audio/pcm",
+}
+
+// AudioOutputConfig selects the voice and encoding of generated audio.
+type AudioOutputConfig struct {
+	// Voice is the voice to speak with, e.g. "alloy"
+	Voice string `json:"voice"`
+	// Format is the audio encoding, e.g. "wav" or "mp3"
+	Format string `json:"format"`
+}
+
+// inputAudio is the OpenAI input_audio object.
+type inputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+// isAudio reports whether blob holds audio data.
+func isAudio(blob *genai.Blob) bool {
+	return blob != nil && strings.HasPrefix(strings.ToLower(blob.MIMEType), "audio/")
+}
+
+// audioFormat returns the input_audio format for an audio MIME type.
+func audioFormat(mimeType string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return "", false
+	}
+	format, ok := audioFormats[mediaType]
+	return format, ok
+}
+
+// convertAudioPart converts inline audio data to an input_audio content part.
+func convertAudioPart(blob *genai.Blob) (openai.ChatMessagePart, error) {
+	format, ok := audioFormat(blob.MIMEType)
+	if !ok {
+		return openai.ChatMessagePart{}, fmt.Errorf("unsupported audio MIME type %q", blob.MIMEType)
+	}
+	data, err := json.Marshal(inputAudio{
+		Data:   base64.StdEncoding.EncodeToString(blob.Data),
+		Format: format,
+	})
+	if err != nil {
+		return openai.ChatMessagePart{}, fmt.Errorf("failed to marshal audio part: %w", err)
+	}
+	return openai.ChatMessagePart{Type: chatMessagePartTypeInputAudio, Text: string(data)}, nil
+}
+
+// isImage reports whether blob holds image data.
+func isImage(blob *genai.Blob) bool {
+	return blob != nil && strings.HasPrefix(strings.ToLower(blob.MIMEType), "image/")
+}
+
+// isImageFile reports whether file references an image by URI.
+func isImageFile(file *genai.FileData) bool {
+	return file != nil && file.FileURI != "" && strings.HasPrefix(strings.ToLower(file.MIMEType), "image/")
+}
+
+// convertImagePart converts an image URL, which may be a data URL, to an
+// image_url content part at the given detail level ("auto" when empty).
+func convertImagePart(url, detail string) openai.ChatMessagePart {
+	if detail == "" {
+		detail = string(openai.ImageURLDetailAuto)
+	}
+	return openai.ChatMessagePart{
+		Type: openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{
+			URL:    url,
+			Detail: openai.ImageURLDetail(detail),
+		},
+	}
+}
+
+// imageDataURL encodes inline image data as a data URL.
+func imageDataURL(blob *genai.Blob) string {
+	return "data:" + blob.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(blob.Data)
+}
+
+// hasInputAudio reports whether any message carries an input_audio part.
+func hasInputAudio(messages []openai.ChatCompletionMessage) bool {
+	for _, msg := range messages {
+		for _, part := range msg.MultiContent {
+			if part.Type == chatMessagePartTypeInputAudio {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// responseAudio accumulates audio returned by the model. Streamed audio
+// arrives as a sequence of separately encoded chunks.
+type responseAudio struct {
+	data       []byte
+	transcript string
+}
+
+// audioPayload is the audio object of a message or stream delta.
+type audioPayload struct {
+	Data       string `json:"data"`
+	Transcript string `json:"transcript"`
+}
+
+// add appends one audio payload. Chunks that are not valid base64 are skipped.
+func (a *responseAudio) add(payload *audioPayload) {
+	if data, err := base64.StdEncoding.DecodeString(payload.Data); err == nil {
+		a.data = append(a.data, data...)
+	}
+	a.transcript += payload.Transcript
+}
+
+// attach adds the audio to content as an inline data part. When the model
+// returned no text, the transcript is added as a text part as well.
+func (a *responseAudio) attach(content *genai.Content, format string) {
+	hasText := false
+	for _, part := range content.Parts {
+		if part.Text != "" && !part.Thought {
+			hasText = true
+		}
+	}
+	if !hasText && a.transcript != "" {
+		content.Parts = append(content.Parts, genai.NewPartFromText(a.transcript))
+	}
+	if len(a.data) > 0 {
+		mimeType, ok := audioMIMETypes[format]
+		if !ok {
+			mimeType = "application/octet-stream"
+		}
+		content.Parts = append(content.Parts, genai.NewPartFromBytes(a.data, mimeType))
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// ============================================================================
+// Audio Input Tests
+// ============================================================================
+
+func TestAudioFormat(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+		ok       bool
+	}{
+		{"audio/wav", "wav", true},
+		{"audio/x-wav", "wav", true},
+		{"audio/mpeg", "mp3", true},
+		{"audio/mp3", "mp3", true},
+		{"Audio/MPEG", "mp3", true},
+		{"audio/ogg; codecs=opus", "ogg", true},
+		{"audio/flac", "flac", true},
+		{"audio/unknown", "", false},
+		{"image/png", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			got, ok := audioFormat(tt.mimeType)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("audioFormat(%q) = %q, %v, want %q, %v", tt.mimeType, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestConvertContent_AudioPart(t *testing.T) {
+	m := &OpenRouterModel{}
+	audio := []byte("RIFF fake wav data")
+	content := &genai.Content{
+		Role: genai.RoleUser,
+		Parts: []*genai.Part{
+			genai.NewPartFromText("Transcribe this:"),
+			genai.NewPartFromBytes(audio, "audio/wav"),
+		},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	msg := messages[0]
+	if msg.Content != "" {
+		t.Errorf("expected Content to be unset alongside MultiContent, got %q", msg.Content)
+	}
+	if len(msg.MultiContent) != 2 {
+		t.Fatalf("expected 2 content parts, got %d", len(msg.MultiContent))
+	}
+	if msg.MultiContent[0].Type != openai.ChatMessagePartTypeText || msg.MultiContent[0].Text != "Transcribe this:" {
+		t.Errorf("unexpected text part: %+v", msg.MultiContent[0])
+	}
+	if msg.MultiContent[1].Type != chatMessagePartTypeInputAudio {
+		t.Fatalf("expected input_audio part, got %q", msg.MultiContent[1].Type)
+	}
+	var got inputAudio
+	if err := json.Unmarshal([]byte(msg.MultiContent[1].Text), &got); err != nil {
+		t.Fatalf("failed to decode input_audio payload: %v", err)
+	}
+	if got.Format != "wav" {
+		t.Errorf("expected format wav, got %q", got.Format)
+	}
+	if got.Data != base64.StdEncoding.EncodeToString(audio) {
+		t.Errorf("expected base64 audio data, got %q", got.Data)
+	}
+}
+
+func TestConvertContent_UnsupportedAudio(t *testing.T) {
+	m := &OpenRouterModel{}
+	content := &genai.Content{
+		Role:  genai.RoleUser,
+		Parts: []*genai.Part{genai.NewPartFromBytes([]byte("..."), "audio/x-unknown")},
+	}
+
+	_, err := m.convertContent(content)
+
+	if err == nil {
+		t.Fatal("expected error for unsupported audio MIME type")
+	}
+}
+
+func TestConvertContent_ImageParts(t *testing.T) {
+	tests := []struct {
+		name   string
+		detail string
+		want   openai.ImageURLDetail
+	}{
+		{"default", "", openai.ImageURLDetailAuto},
+		{"low", "low", openai.ImageURLDetailLow},
+		{"high", "high", openai.ImageURLDetailHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &OpenRouterModel{cfg: OpenRouterConfig{ImageDetail: tt.detail}}
+			content := &genai.Content{
+				Role: genai.RoleUser,
+				Parts: []*genai.Part{
+					genai.NewPartFromText("Compare these:"),
+					genai.NewPartFromBytes([]byte("png bytes"), "image/png"),
+					genai.NewPartFromURI("https://example.com/cat.jpg", "image/jpeg"),
+				},
+			}
+
+			messages, err := m.convertContent(content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			parts := messages[0].MultiContent
+			if len(parts) != 3 {
+				t.Fatalf("expected 3 content parts, got %d", len(parts))
+			}
+			wantURLs := []string{
+				"data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("png bytes")),
+				"https://example.com/cat.jpg",
+			}
+			for i, part := range parts[1:] {
+				if part.Type != openai.ChatMessagePartTypeImageURL || part.ImageURL == nil {
+					t.Fatalf("expected image_url part, got %+v", part)
+				}
+				if part.ImageURL.URL != wantURLs[i] {
+					t.Errorf("expected URL %q, got %q", wantURLs[i], part.ImageURL.URL)
+				}
+				if part.ImageURL.Detail != tt.want {
+					t.Errorf("expected detail %q, got %q", tt.want, part.ImageURL.Detail)
+				}
+			}
+		})
+	}
+}
+
+func TestImageDetail_RequestBody(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4o", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithImageDetail("low"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := &model.LLMRequest{Contents: []*genai.Content{{
+		Role:  genai.RoleUser,
+		Parts: []*genai.Part{genai.NewPartFromURI("https://example.com/cat.jpg", "image/jpeg")},
+	}}}
+
+	if _, err := collect(m.GenerateContent(context.Background(), req, false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := body["messages"].([]any)[0].(map[string]any)["content"].([]any)
+	imageURL := content[0].(map[string]any)["image_url"].(map[string]any)
+	if imageURL["detail"] != "low" {
+		t.Errorf("expected detail low in request body, got %v", imageURL)
+	}
+}
+
+func TestImageDetail_Invalid(t *testing.T) {
+	_, err := NewOpenRouterModel("openai/gpt-4o", WithAPIKey("test-api-key"), WithImageDetail("ultra"))
+
+	if err == nil || !strings.Contains(err.Error(), "invalid image detail") {
+		t.Errorf("expected invalid image detail error, got %v", err)
+	}
+}
+
+func TestAudioInput_RequestBody(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4o-audio-preview", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{{
+			Role:  genai.RoleUser,
+			Parts: []*genai.Part{genai.NewPartFromBytes([]byte("ID3 fake mp3"), "audio/mpeg")},
+		}},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), req, false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parts, ok := firstMessageContent(t, body).([]any)
+	if !ok || len(parts) != 1 {
+		t.Fatalf("expected a single content part, got %v", firstMessageContent(t, body))
+	}
+	part := parts[0].(map[string]any)
+	if part["type"] != "input_audio" {
+		t.Errorf("expected type input_audio, got %v", part["type"])
+	}
+	if _, ok := part["text"]; ok {
+		t.Errorf("expected no text field on the audio part, got %v", part["text"])
+	}
+	audio, ok := part["input_audio"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected input_audio object, got %v", part["input_audio"])
+	}
+	if audio["format"] != "mp3" || audio["data"] != base64.StdEncoding.EncodeToString([]byte("ID3 fake mp3")) {
+		t.Errorf("unexpected input_audio object: %v", audio)
+	}
+}
+
+// ============================================================================
+// Audio Output Tests
+// ============================================================================
+
+func TestAudioOutput_RequestBody(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4o-audio-preview",
+		WithAPIKey("test-api-key"),
+		WithBaseURL(server.URL),
+		WithModalities("text", "audio"),
+		WithAudioOutput("alloy", "wav"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Say hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	modalities, ok := body["modalities"].([]any)
+	if !ok || len(modalities) != 2 || modalities[0] != "text" || modalities[1] != "audio" {
+		t.Errorf("expected modalities [text audio], got %v", body["modalities"])
+	}
+	audio, ok := body["audio"].(map[string]any)
+	if !ok || audio["voice"] != "alloy" || audio["format"] != "wav" {
+		t.Errorf("expected audio {voice: alloy, format: wav}, got %v", body["audio"])
+	}
+}
+
+func TestAudioOutput_OmittedByDefault(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"modalities", "audio"} {
+		if _, ok := body[key]; ok {
+			t.Errorf("expected no %s field, got %v", key, body[key])
+		}
+	}
+}
+
+func TestAudioOutput_NonStreamingResponse(t *testing.T) {
+	audio := []byte("RIFF fake wav output")
+	server := newStubServer(t,
+		`{"id":"gen-1","choices":[{"index":0,"message":{"role":"assistant","content":null,"audio":{"id":"audio_1","data":"`+
+			base64.StdEncoding.EncodeToString(audio)+`","transcript":"Hi there!"}},"finish_reason":"stop"}]}`,
+		nil)
+	m, err := NewOpenRouterModel("openai/gpt-4o-audio-preview",
+		WithAPIKey("test-api-key"),
+		WithBaseURL(server.URL),
+		WithModalities("text", "audio"),
+		WithAudioOutput("alloy", "wav"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Say hi"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parts := responses[0].Content.Parts
+	if len(parts) != 2 {
+		t.Fatalf("expected transcript and audio parts, got %d", len(parts))
+	}
+	if parts[0].Text != "Hi there!" {
+		t.Errorf("expected transcript text part, got %+v", parts[0])
+	}
+	if parts[1].InlineData == nil {
+		t.Fatal("expected inline audio part")
+	}
+	if parts[1].InlineData.MIMEType != "audio/wav" {
+		t.Errorf("expected audio/wav, got %q", parts[1].InlineData.MIMEType)
+	}
+	if string(parts[1].InlineData.Data) != string(audio) {
+		t.Errorf("expected decoded audio bytes, got %q", parts[1].InlineData.Data)
+	}
+}
+
+func TestAudioOutput_StreamingResponse(t *testing.T) {
+	chunk1, chunk2 := []byte("first-"), []byte("second")
+	server := newSSEServer(t, []string{
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"role":"assistant","audio":{"data":"` + base64.StdEncoding.EncodeToString(chunk1) + `","transcript":"Hi "}}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"audio":{"data":"` + base64.StdEncoding.EncodeToString(chunk2) + `","transcript":"there!"}}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	}, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4o-audio-preview",
+		WithAPIKey("test-api-key"),
+		WithBaseURL(server.URL),
+		WithModalities("text", "audio"),
+		WithAudioOutput("alloy", "mp3"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Say hi"), true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	final := responses[len(responses)-1]
+	var audioPart *genai.Part
+	for _, part := range final.Content.Parts {
+		if part.InlineData != nil {
+			audioPart = part
+		}
+	}
+	if audioPart == nil {
+		t.Fatal("expected inline audio part on the final response")
+	}
+	if audioPart.InlineData.MIMEType != "audio/mpeg" {
+		t.Errorf("expected audio/mpeg, got %q", audioPart.InlineData.MIMEType)
+	}
+	if string(audioPart.InlineData.Data) != "first-second" {
+		t.Errorf("expected concatenated audio chunks, got %q", audioPart.InlineData.Data)
+	}
+	if final.Content.Parts[0].Text != "Hi there!" {
+		t.Errorf("expected accumulated transcript, got %+v", final.Content.Parts[0])
+	}
+}
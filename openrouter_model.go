@@ -1,13 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"io"
 	"iter"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/adk/model"
 	"google.golang.org/genai"
 )
@@ -16,83 +31,584 @@ import (
 // for use with OpenRouter's OpenAI-compatible API.
 type OpenRouterModel struct {
 	client    *openai.Client
+	chat      chatClient
 	modelName string
+	cfg       OpenRouterConfig
+	rateLimit *rateLimitTracker
+	// lastGenerationID is the generation ID of the most recent completed call
+	lastGenerationID atomic.Pointer[string]
+	// httpClient is the client the OpenAI client sends requests through
+	httpClient *http.Client
 }
 
+// defaultBaseURL is the OpenRouter API endpoint used when no BaseURL is configured.
+const defaultBaseURL = "https://openrouter.ai/api/v1"
+
 // OpenRouterConfig holds configuration options for the OpenRouter model.
 type OpenRouterConfig struct {
 	// APIKey is the OpenRouter API key (required)
 	APIKey string
 	// BaseURL is the OpenRouter API base URL (defaults to https://openrouter.ai/api/v1)
 	BaseURL string
+	// HTTPClient is the HTTP client used for API calls (defaults to http.DefaultClient)
+	HTTPClient *http.Client
+	// Timeout bounds each HTTP request to OpenRouter (optional, no timeout by default)
+	Timeout time.Duration
+	// SiteURL identifies your app to OpenRouter via the HTTP-Referer header (optional)
+	SiteURL string
+	// AppName is shown in OpenRouter rankings via the X-Title header (optional)
+	AppName string
+	// StrictModelName rejects model names not in "provider/model" form at construction
+	StrictModelName bool
+	// Online appends the ":online" variant to the model name, enabling web search (optional)
+	Online bool
+	// Nitro appends the ":nitro" variant to the model name, preferring high-throughput providers (optional)
+	Nitro bool
+	// Logger receives debug logs of requests, responses and token usage (optional)
+	Logger *slog.Logger
+	// Tracer records an OpenTelemetry span per GenerateContent call (optional, no-op if nil)
+	Tracer trace.Tracer
+	// OnUsage is called once per completed turn with its token usage (optional)
+	OnUsage func(model string, usage genai.GenerateContentResponseUsageMetadata)
+	// IncludeCost asks OpenRouter for the cost of each call; read it with ResponseCost
+	IncludeCost bool
+	// LogitBias maps token IDs (as strings) to a bias from -100 to 100 (optional)
+	LogitBias map[string]int
+	// EndUserID identifies the end user for abuse detection and rate-limit attribution (optional)
+	EndUserID string
+	// ParallelToolCalls enables or disables parallel tool calling (optional, provider default if nil)
+	ParallelToolCalls *bool
+	// MaxContextTokens drops the oldest messages so the estimated prompt fits (optional, 0 disables)
+	MaxContextTokens int
+	// MinP sets the min_p sampling parameter (optional, provider default if nil)
+	MinP *float32
+	// TopA sets the top_a sampling parameter (optional, provider default if nil)
+	TopA *float32
+	// RepetitionPenalty sets the repetition_penalty sampling parameter (optional, provider default if nil)
+	RepetitionPenalty *float32
+	// MaxRetries is how many times a response without choices is retried (optional, 0 disables)
+	MaxRetries int
+	// Retryer decides which failed non-streaming calls are retried and when, replacing MaxRetries (optional)
+	Retryer Retryer
+	// CacheSystemPrompt marks the system message as cacheable on models that support prompt caching (optional)
+	CacheSystemPrompt bool
+	// Transforms lists OpenRouter prompt transforms such as "middle-out" (optional)
+	Transforms []string
+	// Modalities lists the output modalities to request, e.g. ["text", "audio"] (optional)
+	Modalities []string
+	// Audio selects the voice and format of audio output (optional)
+	Audio *AudioOutputConfig
+	// DefaultMaxTokens caps completion tokens when a request sets no MaxOutputTokens (optional)
+	DefaultMaxTokens int
+	// ShrinkOnOverflow retries once with the oldest history trimmed after a context-length error (optional)
+	ShrinkOnOverflow bool
+	// IncludeThoughtsInHistory sends thought parts of earlier turns back as text (optional, dropped by default)
+	IncludeThoughtsInHistory bool
+	// DataCollection restricts routing by provider data policy, "allow" or "deny" (optional)
+	DataCollection string
+	// Quantizations limits routing to backends serving these quantizations, e.g. ["fp16", "fp8"] (optional)
+	Quantizations []string
+	// MaxPrice limits routing to providers within the given per-token prices (optional)
+	MaxPrice *MaxPrice
+	// ProviderSort orders providers by "price", "throughput" or "latency" (optional, load-balanced by default)
+	ProviderSort string
+	// StrictSampling rejects out-of-range temperature and top_p instead of clamping them (optional)
+	StrictSampling bool
+	// ScalarStop sends a single stop sequence as a string rather than a one-element array (optional)
+	ScalarStop bool
+	// Plugins enables OpenRouter plugins such as web search (optional)
+	Plugins []Plugin
+	// ImageDetail is the detail level of image parts: "low", "high" or "auto" (optional, "auto" by default)
+	ImageDetail string
+	// ExtraBody holds arbitrary top-level request fields; fields the wrapper sets take precedence (optional)
+	ExtraBody map[string]any
+	// Cache serves repeated calls with temperature 0 from stored responses (optional)
+	Cache Cache
+	// StrictTools marks function tools strict, so arguments exactly match their schema (optional)
+	StrictTools bool
+	// CloseObjectSchemas sets additionalProperties:false on every object in tool schemas; implied by StrictTools (optional)
+	CloseObjectSchemas bool
+	// MaxSchemaDepth limits how deeply tool parameter schemas may nest (optional, 50 by default)
+	MaxSchemaDepth int
+	// StreamChunkMinChars buffers streamed text until this many characters are pending (optional, 0 yields every delta)
+	StreamChunkMinChars int
+	// Moderator checks user text before each call and blocks flagged prompts (optional)
+	Moderator Moderator
+	// ValidateToolCalls rejects requests with tool responses that answer no earlier tool call (optional)
+	ValidateToolCalls bool
+	// UseNumberArgs decodes numeric tool call arguments as json.Number instead of float64 (optional)
+	UseNumberArgs bool
+	// MaxMessages rejects requests with more messages than this after truncation (optional, 0 = unlimited)
+	MaxMessages int
+	// MaxRequestBytes rejects requests whose encoded body is larger than this (optional, 0 = unlimited)
+	MaxRequestBytes int
+	// PartialOnCancel yields the text streamed so far as a final response when the context is cancelled (optional)
+	PartialOnCancel bool
+	// IdempotencyKeys sends a generated Idempotency-Key header per call, kept across retries (optional)
+	IdempotencyKeys bool
+	// FinishReasons maps additional finish reasons, or overrides built-in mappings (optional)
+	FinishReasons map[string]genai.FinishReason
+	// Metadata tags requests, e.g. by feature or tenant, for analytics and cost breakdowns (optional)
+	Metadata map[string]string
+	// InsecureSkipVerify disables TLS certificate verification; ignored with a custom HTTPClient (optional, testing only)
+	InsecureSkipVerify bool
+	// BeforeRequest can modify each converted request just before it is sent (optional)
+	BeforeRequest func(*openai.ChatCompletionRequest)
+	// AfterResponse is called with each response, partial or final, before it is yielded (optional)
+	AfterResponse func(*model.LLMResponse)
+}
+
+// Plugin enables an OpenRouter plugin for each call, e.g. {ID: "web"} for web
+// search.
+type Plugin struct {
+	// ID names the plugin, e.g. "web"
+	ID string `json:"id"`
+	// MaxResults caps the number of web search results (optional)
+	MaxResults int `json:"max_results,omitempty"`
+	// SearchPrompt replaces the prompt used to attach search results (optional)
+	SearchPrompt string `json:"search_prompt,omitempty"`
+}
+
+// MaxPrice caps what a request may cost, in USD per million tokens. Zero
+// fields are left unconstrained.
+type MaxPrice struct {
+	// Prompt is the maximum price of prompt tokens
+	Prompt float64 `json:"prompt,omitempty"`
+	// Completion is the maximum price of completion tokens
+	Completion float64 `json:"completion,omitempty"`
 }
 
 // NewOpenRouterModel creates a new OpenRouter model instance.
 // modelName should be in OpenRouter format, e.g., "openai/gpt-4", "anthropic/claude-3-opus"
-func NewOpenRouterModel(modelName string, cfg *OpenRouterConfig) (*OpenRouterModel, error) {
-	if cfg == nil || cfg.APIKey == "" {
+//
+// Configuration is given as options, e.g. WithAPIKey, or as a *OpenRouterConfig,
+// which is itself an Option. Options are applied in order.
+func NewOpenRouterModel(modelName string, opts ...Option) (*OpenRouterModel, error) {
+	var cfg OpenRouterConfig
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(&cfg)
+		}
+	}
+	if cfg.APIKey == "" {
 		return nil, fmt.Errorf("OpenRouter API key is required")
 	}
+	if cfg.StrictModelName {
+		if err := validateModelName(modelName); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Online {
+		modelName = withModelVariant(modelName, "online")
+	}
+	if cfg.Nitro {
+		modelName = withModelVariant(modelName, "nitro")
+	}
+	if cfg.DataCollection != "" && cfg.DataCollection != "allow" && cfg.DataCollection != "deny" {
+		return nil, fmt.Errorf("invalid data collection policy %q: must be \"allow\" or \"deny\"", cfg.DataCollection)
+	}
+	switch cfg.ProviderSort {
+	case "", "price", "throughput", "latency":
+	default:
+		return nil, fmt.Errorf("invalid provider sort %q: must be \"price\", \"throughput\" or \"latency\"", cfg.ProviderSort)
+	}
+	switch openai.ImageURLDetail(cfg.ImageDetail) {
+	case "", openai.ImageURLDetailLow, openai.ImageURLDetailHigh, openai.ImageURLDetailAuto:
+	default:
+		return nil, fmt.Errorf("invalid image detail %q: must be \"low\", \"high\" or \"auto\"", cfg.ImageDetail)
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL
+	}
 
 	config := openai.DefaultConfig(cfg.APIKey)
-	if cfg.BaseURL != "" {
-		config.BaseURL = cfg.BaseURL
-	} else {
-		config.BaseURL = "https://openrouter.ai/api/v1"
-	}
+	config.BaseURL = cfg.BaseURL
+	httpClient := newHTTPClient(cfg)
+	config.HTTPClient = httpClient
 
+	client := openai.NewClientWithConfig(config)
 	return &OpenRouterModel{
-		client:    openai.NewClientWithConfig(config),
-		modelName: modelName,
+		client:     client,
+		chat:       openaiChatClient{client},
+		modelName:  modelName,
+		cfg:        cfg,
+		rateLimit:  &rateLimitTracker{},
+		httpClient: httpClient,
 	}, nil
 }
 
+// validateModelName checks that name has OpenRouter's "provider/model" form,
+// e.g. "openai/gpt-4". A variant suffix such as ":free" is allowed.
+func validateModelName(name string) error {
+	provider, model, ok := strings.Cut(name, "/")
+	if !ok || provider == "" || model == "" || strings.Contains(model, "/") {
+		return fmt.Errorf("invalid model name %q: expected \"provider/model\" form, e.g. \"openai/gpt-4\"", name)
+	}
+	return nil
+}
+
+// withModelVariant appends the ":variant" suffix to name unless name already
+// carries it, e.g. "openai/gpt-4" becomes "openai/gpt-4:online".
+func withModelVariant(name, variant string) string {
+	if _, suffixes, ok := strings.Cut(name, ":"); ok && slices.Contains(strings.Split(suffixes, ":"), variant) {
+		return name
+	}
+	return name + ":" + variant
+}
+
+// reportUsage passes the usage of a completed turn to the OnUsage callback.
+func (m *OpenRouterModel) reportUsage(ctx context.Context, resp *model.LLMResponse) {
+	if m.cfg.OnUsage != nil && resp.UsageMetadata != nil {
+		m.cfg.OnUsage(m.requestModel(ctx), *resp.UsageMetadata)
+	}
+}
+
 // Name returns the model name.
 func (m *OpenRouterModel) Name() string {
 	return m.modelName
 }
 
+type modelOverrideKey struct{}
+
+// ContextWithModel returns a copy of ctx that makes GenerateContent calls use
+// the named model instead of the one the OpenRouterModel was created with, so
+// one instance can route different steps to different models. The name is
+// sent as given, without validation.
+func ContextWithModel(ctx context.Context, modelName string) context.Context {
+	return context.WithValue(ctx, modelOverrideKey{}, modelName)
+}
+
+// requestModel returns the model to call for ctx: the ContextWithModel
+// override if set, otherwise the configured model.
+func (m *OpenRouterModel) requestModel(ctx context.Context) string {
+	if name, ok := ctx.Value(modelOverrideKey{}).(string); ok && name != "" {
+		return name
+	}
+	return m.modelName
+}
+
+type predictionKey struct{}
+
+// ContextWithPrediction returns a copy of ctx that sends content as the
+// predicted output of GenerateContent calls made with it. A prediction is the
+// expected text of one specific edit, such as the file being rewritten, so it
+// is attached per call rather than configured on the model.
+func ContextWithPrediction(ctx context.Context, content string) context.Context {
+	return context.WithValue(ctx, predictionKey{}, content)
+}
+
+// Client returns the underlying OpenAI client, already configured with the
+// OpenRouter API key and base URL, for endpoints this wrapper does not cover.
+func (m *OpenRouterModel) Client() *openai.Client {
+	return m.client
+}
+
+// Close releases idle connections held by the HTTP transport the model
+// created for itself; a transport supplied through HTTPClient is left to its
+// owner. The model remains usable; new connections are opened as needed. It
+// is safe to call more than once.
+func (m *OpenRouterModel) Close() error {
+	if m.httpClient != nil {
+		m.httpClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Ping checks connectivity and authentication by looking up the API key's
+// details, without running a generation. It honors the configured Timeout.
+// Failures match ErrUnauthorized or ErrUnreachable via errors.Is where they
+// apply.
+func (m *OpenRouterModel) Ping(ctx context.Context) error {
+	resp, err := m.apiGet(ctx, "/key")
+	if err != nil {
+		return fmt.Errorf("openrouter ping: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("openrouter ping: %w (status %d)", ErrUnauthorized, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("openrouter ping: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// apiGet sends an authenticated GET request for path, relative to the base
+// URL, through the model's HTTP client. Transport failures are wrapped with
+// ErrUnreachable.
+func (m *OpenRouterModel) apiGet(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(m.cfg.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.cfg.APIKey)
+
+	httpClient := m.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+	return resp, nil
+}
+
 // GenerateContent implements the model.LLM interface.
 // It converts ADK requests to OpenAI format, calls OpenRouter, and converts responses back.
+//
+// The model is safe for concurrent use: each call keeps its own stream state.
+// A single returned iterator, however, must be consumed by one goroutine, as
+// with any iter.Seq2. Responses are yielded synchronously from that
+// goroutine's range loop, so the streaming accumulators are never shared.
 func (m *OpenRouterModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
 	return func(yield func(*model.LLMResponse, error) bool) {
+		ctx, span := m.startSpan(ctx, stream)
+		defer span.End()
+		yield = tracedYield(span, yield)
+		if m.cfg.AfterResponse != nil {
+			yield = hookedYield(m.cfg.AfterResponse, yield)
+		}
+
+		if err := m.moderate(ctx, req); err != nil {
+			yield(nil, err)
+			return
+		}
+
 		// Convert ADK request to OpenAI format
-		openaiReq, err := m.convertRequest(req)
+		openaiReq, err := m.convertRequest(req, m.requestModel(ctx))
 		if err != nil {
 			yield(nil, fmt.Errorf("failed to convert request: %w", err))
 			return
 		}
+		if prediction, ok := ctx.Value(predictionKey{}).(string); ok && prediction != "" {
+			openaiReq.Prediction = &openai.Prediction{Type: "content", Content: prediction}
+		}
+		if m.cfg.BeforeRequest != nil {
+			m.cfg.BeforeRequest(&openaiReq)
+		}
+
+		if m.cfg.Cache != nil && isDeterministic(req) {
+			key, err := m.cacheKey(openaiReq)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if cached, ok := m.cfg.Cache.Get(ctx, key); ok {
+				// A hit is served as the final response alone, even when
+				// streaming, as a copy the caller is free to modify
+				yield(cacheHit(cached), nil)
+				return
+			}
+			yield = m.cachingYield(ctx, key, yield)
+		}
+
+		if m.cfg.ShrinkOnOverflow {
+			// Hold back a context-length error so the call can be retried
+			// once with the oldest history trimmed
+			var overflowErr error
+			m.send(ctx, openaiReq, stream, func(resp *model.LLMResponse, err error) bool {
+				if errors.Is(err, ErrContextLengthExceeded) {
+					overflowErr = err
+					return false
+				}
+				return yield(resp, err)
+			})
+			if overflowErr == nil {
+				return
+			}
+			if !shrinkForOverflow(&openaiReq, overflowErr) {
+				yield(nil, overflowErr)
+				return
+			}
+		}
+
+		m.send(ctx, openaiReq, stream, yield)
+	}
+}
+
+// send issues a single call for an already converted request.
+func (m *OpenRouterModel) send(ctx context.Context, openaiReq openai.ChatCompletionRequest, stream bool, yield func(*model.LLMResponse, error) bool) {
+	body := m.extraBody()
+	if m.cfg.ScalarStop && len(openaiReq.Stop) == 1 {
+		// go-openai always encodes stop as an array
+		body["stop"] = openaiReq.Stop[0]
+		openaiReq.Stop = nil
+	}
+
+	m.logJSON(ctx, "openrouter request", "request", openaiReq)
+	ctx = withCallState(ctx, &callState{
+		body:        body,
+		headers:     m.requestHeaders(ctx),
+		cacheSystem: m.cfg.CacheSystemPrompt && supportsPromptCaching(openaiReq.Model),
+		inputAudio:  hasInputAudio(openaiReq.Messages),
+		rateLimit:   m.rateLimit,
+	})
+
+	if stream {
+		m.handleStreamingResponse(ctx, openaiReq, yield)
+	} else {
+		m.handleNonStreamingResponse(ctx, openaiReq, yield)
+	}
+}
+
+// requestHeaders returns the per-request headers of a call. With
+// IdempotencyKeys set, a fresh Idempotency-Key is added unless the caller
+// supplied one; retries within the call reuse it.
+func (m *OpenRouterModel) requestHeaders(ctx context.Context) http.Header {
+	headers := requestHeadersFrom(ctx)
+	if !m.cfg.IdempotencyKeys || headers.Get(idempotencyKeyHeader) != "" {
+		return headers
+	}
+	headers = headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(idempotencyKeyHeader, newIdempotencyKey())
+	return headers
+}
+
+// newIdempotencyKey returns a random key identifying one logical call.
+func newIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// hookedYield wraps yield so that hook sees every response before the caller.
+func hookedYield(hook func(*model.LLMResponse), yield func(*model.LLMResponse, error) bool) func(*model.LLMResponse, error) bool {
+	return func(resp *model.LLMResponse, err error) bool {
+		if resp != nil {
+			hook(resp)
+		}
+		return yield(resp, err)
+	}
+}
+
+// GenerateContentSync streams a completion and returns the single assembled
+// response, with the full text, tool calls, finish reason and usage. It
+// fails if the stream ends before the turn completes.
+func (m *OpenRouterModel) GenerateContentSync(ctx context.Context, req *model.LLMRequest) (*model.LLMResponse, error) {
+	var final *model.LLMResponse
+	for resp, err := range m.GenerateContent(ctx, req, true) {
+		if err != nil {
+			return nil, err
+		}
+		if !resp.Partial {
+			final = resp
+		}
+	}
+	if final == nil {
+		return nil, fmt.Errorf("openrouter stream ended without a final response")
+	}
+	return final, nil
+}
+
+// Continue asks the model to carry on from a truncated response (see
+// IsTruncated). It resends prevReq, with its generation config and tools,
+// followed by the partial assistant output in prevResp. Partial responses
+// carry only the new text; the final response's text is the previous output
+// followed by the continuation, so it holds the whole reply.
+func (m *OpenRouterModel) Continue(ctx context.Context, prevReq *model.LLMRequest, prevResp *model.LLMResponse, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		if prevReq == nil || prevResp == nil || prevResp.Content == nil {
+			yield(nil, fmt.Errorf("openrouter continue: previous request and response are required"))
+			return
+		}
+
+		partial := &genai.Content{Role: genai.RoleModel}
+		var prevText []string
+		for _, part := range prevResp.Content.Parts {
+			if part.Text != "" && !part.Thought {
+				partial.Parts = append(partial.Parts, genai.NewPartFromText(part.Text))
+				prevText = append(prevText, part.Text)
+			}
+		}
+		if len(partial.Parts) == 0 {
+			yield(nil, fmt.Errorf("openrouter continue: previous response has no text to continue"))
+			return
+		}
 
-		if stream {
-			m.handleStreamingResponse(ctx, openaiReq, yield)
-		} else {
-			m.handleNonStreamingResponse(ctx, openaiReq, yield)
+		req := *prevReq
+		req.Contents = append(append([]*genai.Content(nil), prevReq.Contents...), partial)
+
+		for resp, err := range m.GenerateContent(ctx, &req, stream) {
+			if err == nil && !resp.Partial && resp.Content != nil {
+				prependText(resp.Content, joinStrings(prevText))
+			}
+			if !yield(resp, err) {
+				return
+			}
 		}
 	}
 }
 
-// convertRequest converts an ADK LLMRequest to an OpenAI ChatCompletionRequest.
-func (m *OpenRouterModel) convertRequest(req *model.LLMRequest) (openai.ChatCompletionRequest, error) {
+// prependText adds text before the first non-thought text of content,
+// inserting a text part after any thought parts if there is none.
+func prependText(content *genai.Content, text string) {
+	pos := 0
+	for i, part := range content.Parts {
+		if part.Thought {
+			pos = i + 1
+			continue
+		}
+		if part.Text != "" {
+			part.Text = text + part.Text
+			return
+		}
+	}
+	content.Parts = append(content.Parts, nil)
+	copy(content.Parts[pos+1:], content.Parts[pos:])
+	content.Parts[pos] = genai.NewPartFromText(text)
+}
+
+// BuildRequest returns the OpenAI request GenerateContent would send for req
+// with ctx, without calling the API. It is useful for inspecting prompt
+// assembly. OpenRouter-only fields added by the transport are not included.
+func (m *OpenRouterModel) BuildRequest(ctx context.Context, req *model.LLMRequest) (openai.ChatCompletionRequest, error) {
+	return m.convertRequest(req, m.requestModel(ctx))
+}
+
+// convertRequest converts an ADK LLMRequest to an OpenAI ChatCompletionRequest
+// for modelName, the model the request will be sent to.
+func (m *OpenRouterModel) convertRequest(req *model.LLMRequest, modelName string) (openai.ChatCompletionRequest, error) {
 	openaiReq := openai.ChatCompletionRequest{
-		Model: m.modelName,
+		Model: modelName,
+	}
+
+	// System text is gathered from the instruction and any system-role
+	// contents, then sent as a single leading system message
+	var systemTexts []string
+	if req.Config != nil && req.Config.SystemInstruction != nil {
+		systemTexts = append(systemTexts, extractText(req.Config.SystemInstruction, "\n"))
 	}
 
 	// Convert messages
 	for _, content := range req.Contents {
-		msg, err := m.convertContent(content)
+		msgs, err := m.convertContent(content)
 		if err != nil {
 			return openaiReq, err
 		}
-		openaiReq.Messages = append(openaiReq.Messages, msg...)
+		for _, msg := range msgs {
+			if msg.Role == openai.ChatMessageRoleSystem {
+				// A system content with media parts carries its text in
+				// MultiContent; only the text is merged
+				systemTexts = append(systemTexts, msg.Content, multiContentText(msg.MultiContent))
+				continue
+			}
+			openaiReq.Messages = append(openaiReq.Messages, msg)
+		}
 	}
 
-	// Convert system instruction if present
-	if req.Config != nil && req.Config.SystemInstruction != nil {
+	// Prepend the merged system message, unless there is no system text;
+	// some providers reject an empty one
+	if systemText := joinNonEmpty(systemTexts, "\n"); systemText != "" {
 		sysMsg := openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: extractText(req.Config.SystemInstruction),
+			Content: systemText,
 		}
-		// Prepend system message
 		openaiReq.Messages = append([]openai.ChatCompletionMessage{sysMsg}, openaiReq.Messages...)
 	}
 
@@ -101,7 +617,16 @@ func (m *OpenRouterModel) convertRequest(req *model.LLMRequest) (openai.ChatComp
 		for _, tool := range req.Config.Tools {
 			if tool.FunctionDeclarations != nil {
 				for _, fn := range tool.FunctionDeclarations {
-					openaiReq.Tools = append(openaiReq.Tools, convertFunctionDeclaration(fn))
+					converted, err := convertFunctionDeclaration(fn, m.cfg.MaxSchemaDepth)
+					if err != nil {
+						return openaiReq, err
+					}
+					if m.cfg.StrictTools {
+						makeStrict(converted.Function, fn)
+					} else if m.cfg.CloseObjectSchemas && fn.Parameters != nil {
+						closeObjectSchemas(converted.Function.Parameters.(map[string]any))
+					}
+					openaiReq.Tools = append(openaiReq.Tools, converted)
 				}
 			}
 		}
@@ -110,23 +635,206 @@ func (m *OpenRouterModel) convertRequest(req *model.LLMRequest) (openai.ChatComp
 	// Apply generation config
 	if req.Config != nil {
 		if req.Config.Temperature != nil {
-			openaiReq.Temperature = *req.Config.Temperature
+			temperature, err := m.checkRange("temperature", *req.Config.Temperature, 0, 2)
+			if err != nil {
+				return openaiReq, err
+			}
+			openaiReq.Temperature = temperature
 		}
 		if req.Config.TopP != nil {
-			openaiReq.TopP = *req.Config.TopP
+			topP, err := m.checkRange("top_p", *req.Config.TopP, 0, 1)
+			if err != nil {
+				return openaiReq, err
+			}
+			openaiReq.TopP = topP
 		}
 		if req.Config.MaxOutputTokens > 0 {
 			openaiReq.MaxCompletionTokens = int(req.Config.MaxOutputTokens)
 		}
-		if len(req.Config.StopSequences) > 0 {
-			openaiReq.Stop = req.Config.StopSequences
+		// Empty sequences are dropped so "stop" is omitted rather than
+		// sent as [] or [""]
+		for _, stop := range req.Config.StopSequences {
+			if stop != "" {
+				openaiReq.Stop = append(openaiReq.Stop, stop)
+			}
 		}
 	}
 
+	// Apply model-level settings
+	if openaiReq.MaxCompletionTokens == 0 && m.cfg.DefaultMaxTokens > 0 {
+		// A per-request MaxOutputTokens always wins over the default
+		openaiReq.MaxCompletionTokens = m.cfg.DefaultMaxTokens
+	}
+	if len(m.cfg.LogitBias) > 0 {
+		openaiReq.LogitBias = m.cfg.LogitBias
+	}
+	if m.cfg.EndUserID != "" {
+		openaiReq.User = m.cfg.EndUserID
+	}
+	if len(m.cfg.Metadata) > 0 {
+		openaiReq.Metadata = m.cfg.Metadata
+	}
+	if m.cfg.ParallelToolCalls != nil {
+		openaiReq.ParallelToolCalls = *m.cfg.ParallelToolCalls
+	}
+
+	if m.cfg.ValidateToolCalls {
+		if err := validateToolCallIDs(openaiReq.Messages); err != nil {
+			return openaiReq, err
+		}
+	}
+
+	// Drop the oldest history so the prompt fits the context window
+	if m.cfg.MaxContextTokens > 0 {
+		toolTokens, err := countToolTokens(openaiReq.Tools)
+		if err != nil {
+			return openaiReq, err
+		}
+		budget := gptTokenBudget(m.cfg.MaxContextTokens, modelName) - toolTokens - tokensPerReply
+		openaiReq.Messages = truncateMessages(openaiReq.Messages, budget)
+	}
+
+	if err := m.checkRequestSize(openaiReq); err != nil {
+		return openaiReq, err
+	}
+
 	return openaiReq, nil
 }
 
+// checkRequestSize enforces MaxMessages and MaxRequestBytes, so runaway
+// histories fail fast rather than being sent.
+func (m *OpenRouterModel) checkRequestSize(openaiReq openai.ChatCompletionRequest) error {
+	if m.cfg.MaxMessages > 0 && len(openaiReq.Messages) > m.cfg.MaxMessages {
+		return fmt.Errorf("%w: %d messages exceed the limit of %d", ErrRequestTooLarge, len(openaiReq.Messages), m.cfg.MaxMessages)
+	}
+	if m.cfg.MaxRequestBytes > 0 {
+		body, err := json.Marshal(openaiReq)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		if len(body) > m.cfg.MaxRequestBytes {
+			return fmt.Errorf("%w: %d bytes exceed the limit of %d", ErrRequestTooLarge, len(body), m.cfg.MaxRequestBytes)
+		}
+	}
+	return nil
+}
+
+// validateToolCallIDs checks that every tool message answers a tool call made
+// by an earlier assistant message, which providers otherwise reject with an
+// opaque 400 error.
+func validateToolCallIDs(messages []openai.ChatCompletionMessage) error {
+	calls := make(map[string]bool)
+	for i, msg := range messages {
+		switch msg.Role {
+		case openai.ChatMessageRoleAssistant:
+			for _, call := range msg.ToolCalls {
+				calls[call.ID] = true
+			}
+		case openai.ChatMessageRoleTool:
+			if !calls[msg.ToolCallID] {
+				return fmt.Errorf("message %d: tool response for %q has no matching earlier tool call (ID %q)", i, msg.Name, msg.ToolCallID)
+			}
+		}
+	}
+	return nil
+}
+
+// promptCachingPrefixes lists the model families that honour cache_control
+// markers on message content.
+var promptCachingPrefixes = []string{"anthropic/", "google/gemini"}
+
+// supportsPromptCaching reports whether modelName accepts cache_control markers.
+func supportsPromptCaching(modelName string) bool {
+	for _, prefix := range promptCachingPrefixes {
+		if strings.HasPrefix(modelName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRange clamps a sampling parameter to [lo, hi], logging a warning, or
+// with StrictSampling set rejects an out-of-range value. NaN has no sensible
+// clamp and is rejected in both modes.
+func (m *OpenRouterModel) checkRange(name string, value, lo, hi float32) (float32, error) {
+	if math.IsNaN(float64(value)) {
+		return 0, fmt.Errorf("%s is NaN", name)
+	}
+	if value >= lo && value <= hi {
+		return value, nil
+	}
+	if m.cfg.StrictSampling {
+		return 0, fmt.Errorf("%s %v is out of range [%v, %v]", name, value, lo, hi)
+	}
+	clamped := min(max(value, lo), hi)
+	m.logWarn("openrouter clamped sampling parameter",
+		slog.String("param", name),
+		slog.Float64("value", float64(value)),
+		slog.Float64("clamped", float64(clamped)),
+	)
+	return clamped, nil
+}
+
+// extraBody returns OpenRouter-specific top-level request fields that
+// openai.ChatCompletionRequest cannot express. openRouterTransport merges
+// them into the JSON request body.
+func (m *OpenRouterModel) extraBody() map[string]any {
+	extra := make(map[string]any, len(m.cfg.ExtraBody))
+	// Arbitrary fields go in first, so everything set below replaces them
+	maps.Copy(extra, m.cfg.ExtraBody)
+	if m.cfg.IncludeCost {
+		extra["usage"] = map[string]any{"include": true}
+	}
+	if m.cfg.MinP != nil {
+		extra["min_p"] = *m.cfg.MinP
+	}
+	if m.cfg.TopA != nil {
+		extra["top_a"] = *m.cfg.TopA
+	}
+	if m.cfg.RepetitionPenalty != nil {
+		extra["repetition_penalty"] = *m.cfg.RepetitionPenalty
+	}
+	if len(m.cfg.Transforms) > 0 {
+		extra["transforms"] = m.cfg.Transforms
+	}
+	if len(m.cfg.Modalities) > 0 {
+		extra["modalities"] = m.cfg.Modalities
+	}
+	if m.cfg.Audio != nil {
+		extra["audio"] = m.cfg.Audio
+	}
+	if len(m.cfg.Plugins) > 0 {
+		extra["plugins"] = m.cfg.Plugins
+	}
+	if provider := m.providerPreferences(); len(provider) > 0 {
+		extra["provider"] = provider
+	}
+	return extra
+}
+
+// providerPreferences returns the OpenRouter provider routing block.
+func (m *OpenRouterModel) providerPreferences() map[string]any {
+	provider := make(map[string]any)
+	if m.cfg.DataCollection != "" {
+		provider["data_collection"] = m.cfg.DataCollection
+	}
+	if len(m.cfg.Quantizations) > 0 {
+		provider["quantizations"] = m.cfg.Quantizations
+	}
+	if m.cfg.MaxPrice != nil {
+		provider["max_price"] = m.cfg.MaxPrice
+	}
+	if m.cfg.ProviderSort != "" {
+		provider["sort"] = m.cfg.ProviderSort
+	}
+	return provider
+}
+
 // convertContent converts a genai.Content to OpenAI ChatCompletionMessage(s).
+// The order is fixed regardless of how parts are interleaved: each function
+// response becomes its own tool message, in part order, and the content's
+// text, media and tool calls follow as one final message. Tool messages come
+// first so they directly follow the assistant turn whose calls they answer.
 func (m *OpenRouterModel) convertContent(content *genai.Content) ([]openai.ChatCompletionMessage, error) {
 	var messages []openai.ChatCompletionMessage
 
@@ -135,14 +843,41 @@ func (m *OpenRouterModel) convertContent(content *genai.Content) ([]openai.ChatC
 	// Check if this content contains function calls or function responses
 	var textParts []string
 	var toolCalls []openai.ToolCall
+	// contentParts keeps text and media in order for multi-part messages
+	var contentParts []openai.ChatMessagePart
+	hasMedia := false
 
 	for _, part := range content.Parts {
+		if part.Thought && !m.cfg.IncludeThoughtsInHistory {
+			// Don't feed prior chain-of-thought back to the model
+			continue
+		}
 		if part.Text != "" {
 			textParts = append(textParts, part.Text)
+			contentParts = append(contentParts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: part.Text,
+			})
+		}
+		if isAudio(part.InlineData) {
+			audioPart, err := convertAudioPart(part.InlineData)
+			if err != nil {
+				return nil, err
+			}
+			contentParts = append(contentParts, audioPart)
+			hasMedia = true
+		}
+		if isImage(part.InlineData) {
+			contentParts = append(contentParts, convertImagePart(imageDataURL(part.InlineData), m.cfg.ImageDetail))
+			hasMedia = true
+		}
+		if isImageFile(part.FileData) {
+			contentParts = append(contentParts, convertImagePart(part.FileData.FileURI, m.cfg.ImageDetail))
+			hasMedia = true
 		}
 		if part.FunctionCall != nil {
 			// Model is requesting a function call
-			argsJSON, err := json.Marshal(part.FunctionCall.Args)
+			argsJSON, err := canonicalJSON(part.FunctionCall.Args)
 			if err != nil {
 				return nil, fmt.Errorf("failed to marshal function call args: %w", err)
 			}
@@ -157,24 +892,34 @@ func (m *OpenRouterModel) convertContent(content *genai.Content) ([]openai.ChatC
 		}
 		if part.FunctionResponse != nil {
 			// This is a tool response - needs special handling
-			responseJSON, err := json.Marshal(part.FunctionResponse.Response)
+			response := part.FunctionResponse.Response
+			if response == nil {
+				// Marshal an empty object rather than "null", which some models reject
+				response = map[string]any{}
+			}
+			responseJSON, err := canonicalJSON(response)
 			if err != nil {
 				return nil, fmt.Errorf("failed to marshal function response: %w", err)
 			}
 			messages = append(messages, openai.ChatCompletionMessage{
 				Role:       openai.ChatMessageRoleTool,
 				Content:    string(responseJSON),
+				Name:       part.FunctionResponse.Name,
 				ToolCallID: part.FunctionResponse.ID,
 			})
 		}
 	}
 
-	// If we have text or tool calls, create a message
-	if len(textParts) > 0 || len(toolCalls) > 0 {
+	// If we have text, media or tool calls, create a message
+	if len(textParts) > 0 || hasMedia || len(toolCalls) > 0 {
 		msg := openai.ChatCompletionMessage{
 			Role: role,
 		}
-		if len(textParts) > 0 {
+		// A tool-call-only turn leaves Content unset so it is omitted from the
+		// JSON body; strict providers reject content: "".
+		if hasMedia {
+			msg.MultiContent = contentParts
+		} else if len(textParts) > 0 {
 			msg.Content = joinStrings(textParts)
 		}
 		if len(toolCalls) > 0 {
@@ -188,30 +933,53 @@ func (m *OpenRouterModel) convertContent(content *genai.Content) ([]openai.ChatC
 
 // handleNonStreamingResponse handles non-streaming API calls.
 func (m *OpenRouterModel) handleNonStreamingResponse(ctx context.Context, req openai.ChatCompletionRequest, yield func(*model.LLMResponse, error) bool) {
-	resp, err := m.client.CreateChatCompletion(ctx, req)
-	if err != nil {
-		yield(nil, fmt.Errorf("openrouter error: %w", err))
-		return
-	}
+	retryer := m.retryer()
+	state := callStateFrom(ctx)
+	var resp openai.ChatCompletionResponse
+	for attempt := 1; ; attempt++ {
+		state.beginAttempt()
+		var err error
+		resp, err = m.chat.CreateChatCompletion(ctx, req)
+		if err == nil {
+			m.logJSON(ctx, "openrouter response", "response", resp)
+			if len(resp.Choices) > 0 {
+				break
+			}
+			// OpenRouter occasionally returns an empty choices list transiently
+			err = ErrNoChoices
+		}
 
-	if len(resp.Choices) == 0 {
-		yield(nil, fmt.Errorf("openrouter returned no choices"))
-		return
+		// A retry that would only start after the deadline is not attempted,
+		// so the last error is returned rather than the context's
+		delay, retry := retryer.NextDelay(attempt, err)
+		if !retry || !fitsDeadline(ctx, delay) {
+			switch {
+			case !errors.Is(err, ErrNoChoices):
+				yield(nil, callError(ctx, "openrouter error", err))
+			case attempt > 1:
+				yield(nil, fmt.Errorf("%w after %d attempts", err, attempt))
+			default:
+				yield(nil, err)
+			}
+			return
+		}
+		if err := sleep(ctx, delay); err != nil {
+			yield(nil, err)
+			return
+		}
 	}
 
 	choice := resp.Choices[0]
 	llmResp := m.convertResponse(&choice.Message)
 	llmResp.TurnComplete = true
-	llmResp.FinishReason = convertFinishReason(choice.FinishReason)
+	llmResp.FinishReason = m.finishReason(choice.FinishReason)
+	m.logCompletion(ctx, choice.FinishReason, resp.Usage)
 
 	// Add usage metadata if available
-	if resp.Usage.TotalTokens > 0 {
-		llmResp.UsageMetadata = &genai.GenerateContentResponseUsageMetadata{
-			PromptTokenCount:     int32(resp.Usage.PromptTokens),
-			CandidatesTokenCount: int32(resp.Usage.CompletionTokens),
-			TotalTokenCount:      int32(resp.Usage.TotalTokens),
-		}
-	}
+	llmResp.UsageMetadata = convertUsage(resp.Usage)
+	m.recordGenerationID(llmResp, resp.ID)
+	m.attachCallMetadata(ctx, llmResp)
+	m.reportUsage(ctx, llmResp)
 
 	yield(llmResp, nil)
 }
@@ -220,41 +988,108 @@ func (m *OpenRouterModel) handleNonStreamingResponse(ctx context.Context, req op
 // handleStreamingResponse handles streaming API calls.
 func (m *OpenRouterModel) handleStreamingResponse(ctx context.Context, req openai.ChatCompletionRequest, yield func(*model.LLMResponse, error) bool) {
 	req.Stream = true
+	// Ask for a trailing usage chunk, sent after the finish reason
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
 
-	stream, err := m.client.CreateChatCompletionStream(ctx, req)
+	stream, err := m.chat.CreateChatCompletionStream(ctx, req)
 	if err != nil {
-		yield(nil, fmt.Errorf("openrouter stream error: %w", err))
+		yield(nil, callError(ctx, "openrouter stream error", err))
 		return
 	}
 	defer stream.Close()
 
 	var accumulatedContent string
+	var accumulatedReasoning string
 	var accumulatedToolCalls []openai.ToolCall
+	var finishReason openai.FinishReason
+	var usage openai.Usage
+	sawUsage := false
+	var generationID string
+
+	// pendingContent holds text not yet yielded as a partial response
+	var pendingContent string
+	flush := func() bool {
+		if pendingContent == "" {
+			return true
+		}
+		llmResp := &model.LLMResponse{
+			Content: genai.NewContentFromText(pendingContent, "model"),
+			Partial: true,
+		}
+		pendingContent = ""
+		return yield(llmResp, nil)
+	}
+
+	// cancelled reports a done context. With PartialOnCancel set, the text
+	// generated so far is first yielded as a final response flagged as
+	// cancelled; incomplete tool calls are not included.
+	cancelled := func(ctxErr error) {
+		if m.cfg.PartialOnCancel && (accumulatedContent != "" || accumulatedReasoning != "") {
+			llmResp := m.convertResponse(&openai.ChatCompletionMessage{
+				Role:             openai.ChatMessageRoleAssistant,
+				Content:          accumulatedContent,
+				ReasoningContent: accumulatedReasoning,
+			})
+			llmResp.TurnComplete = true
+			llmResp.FinishReason = genai.FinishReasonOther
+			llmResp.ErrorCode = CancelledErrorCode
+			llmResp.ErrorMessage = ctxErr.Error()
+			llmResp.UsageMetadata = convertUsage(usage)
+			m.recordGenerationID(llmResp, generationID)
+			if !yield(llmResp, nil) {
+				return
+			}
+		}
+		yield(nil, ctxErr)
+	}
 
 	for {
+		// Stop between chunks as soon as the caller cancels
+		if err := ctx.Err(); err != nil {
+			cancelled(err)
+			return
+		}
+
 		chunk, err := stream.Recv()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			yield(nil, fmt.Errorf("openrouter stream recv error: %w", err))
+			// A cancelled context surfaces as a transport error; report the cause
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				cancelled(ctxErr)
+				return
+			}
+			yield(nil, callError(ctx, "openrouter stream recv error", err))
 			return
 		}
 
+		if chunk.ID != "" {
+			generationID = chunk.ID
+		}
+		if chunk.Usage != nil {
+			usage = mergeUsage(usage, *chunk.Usage)
+			sawUsage = true
+		}
+
 		if len(chunk.Choices) == 0 {
 			continue
 		}
 
 		delta := chunk.Choices[0].Delta
-		finishReason := chunk.Choices[0].FinishReason
+		if chunk.Choices[0].FinishReason != "" {
+			finishReason = chunk.Choices[0].FinishReason
+		}
 
-		// Accumulate content
-		if delta.Content != "" {
-			accumulatedContent += delta.Content
+		// Accumulate reasoning, streamed as partial thought parts
+		if delta.ReasoningContent != "" {
+			accumulatedReasoning += delta.ReasoningContent
 
-			// Yield partial response for text streaming
 			llmResp := &model.LLMResponse{
-				Content: genai.NewContentFromText(delta.Content, "model"),
+				Content: &genai.Content{
+					Role:  "model",
+					Parts: []*genai.Part{{Text: delta.ReasoningContent, Thought: true}},
+				},
 				Partial: true,
 			}
 			if !yield(llmResp, nil) {
@@ -262,71 +1097,198 @@ func (m *OpenRouterModel) handleStreamingResponse(ctx context.Context, req opena
 			}
 		}
 
+		// Accumulate content, yielding it once enough is pending
+		if delta.Content != "" {
+			accumulatedContent += delta.Content
+			pendingContent += delta.Content
+			if utf8.RuneCountInString(pendingContent) >= m.cfg.StreamChunkMinChars && !flush() {
+				return
+			}
+		}
+
 		// Accumulate tool calls
 		for _, tc := range delta.ToolCalls {
-			if tc.Index != nil {
-				idx := *tc.Index
-				// Extend slice if needed
-				for len(accumulatedToolCalls) <= idx {
-					accumulatedToolCalls = append(accumulatedToolCalls, openai.ToolCall{})
-				}
-				// Merge tool call data
-				if tc.ID != "" {
-					accumulatedToolCalls[idx].ID = tc.ID
-				}
-				if tc.Type != "" {
-					accumulatedToolCalls[idx].Type = tc.Type
-				}
-				if tc.Function.Name != "" {
-					accumulatedToolCalls[idx].Function.Name = tc.Function.Name
-				}
-				accumulatedToolCalls[idx].Function.Arguments += tc.Function.Arguments
-			}
+			accumulatedToolCalls = mergeToolCallDelta(accumulatedToolCalls, tc)
 		}
 
-		// Check if stream is complete
-		if finishReason != "" {
-			// Build final response
-			finalMsg := openai.ChatCompletionMessage{
-				Role:      openai.ChatMessageRoleAssistant,
-				Content:   accumulatedContent,
-				ToolCalls: accumulatedToolCalls,
-			}
+	}
 
-			llmResp := m.convertResponse(&finalMsg)
-			llmResp.TurnComplete = true
-			llmResp.Partial = false
-			llmResp.FinishReason = convertFinishReason(finishReason)
+	// Text still buffered by StreamChunkMinChars goes out before the final response
+	if !flush() {
+		return
+	}
 
-			yield(llmResp, nil)
+	// The turn is only complete once a finish reason was seen; the usage
+	// chunk, if any, arrives after it, so the stream is drained first.
+	// Some providers never send a finish reason, only the usage chunk,
+	// which then marks a normal end of turn.
+	if finishReason == "" {
+		if !sawUsage {
 			return
 		}
+		finishReason = openai.FinishReasonStop
+	}
+
+	// A stream cut off mid-call leaves arguments that aren't valid JSON;
+	// such calls are withheld and the turn flagged instead
+	validToolCalls, malformed := splitMalformedToolCalls(accumulatedToolCalls)
+
+	// Build final response
+	finalMsg := openai.ChatCompletionMessage{
+		Role:             openai.ChatMessageRoleAssistant,
+		Content:          accumulatedContent,
+		ReasoningContent: accumulatedReasoning,
+		ToolCalls:        validToolCalls,
+	}
+
+	m.logJSON(ctx, "openrouter response", "response", finalMsg)
+
+	llmResp := m.convertResponse(&finalMsg)
+	llmResp.TurnComplete = true
+	llmResp.Partial = false
+	llmResp.FinishReason = m.finishReason(finishReason)
+	if len(malformed) > 0 {
+		llmResp.FinishReason = genai.FinishReasonMalformedFunctionCall
+		llmResp.ErrorCode = string(genai.FinishReasonMalformedFunctionCall)
+		llmResp.ErrorMessage = fmt.Sprintf("incomplete arguments for tool call(s): %s", strings.Join(malformed, ", "))
+	}
+	llmResp.UsageMetadata = convertUsage(usage)
+	m.recordGenerationID(llmResp, generationID)
+	m.attachCallMetadata(ctx, llmResp)
+	m.logCompletion(ctx, finishReason, usage)
+	m.reportUsage(ctx, llmResp)
+
+	yield(llmResp, nil)
+}
+
+// mergeToolCallDelta merges a streamed tool-call fragment into calls. Fragments
+// are matched by index; providers that omit the index are matched by ID, and
+// a fragment with a new ID starts a new call. A fragment with neither belongs
+// to the call currently in flight.
+func mergeToolCallDelta(calls []openai.ToolCall, tc openai.ToolCall) []openai.ToolCall {
+	idx := -1
+	switch {
+	case tc.Index != nil:
+		idx = *tc.Index
+		// Extend slice if needed
+		for len(calls) <= idx {
+			calls = append(calls, openai.ToolCall{})
+		}
+	case tc.ID != "":
+		for i := range calls {
+			if calls[i].ID == tc.ID {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			calls = append(calls, openai.ToolCall{})
+			idx = len(calls) - 1
+		}
+	case len(calls) == 0:
+		calls = append(calls, openai.ToolCall{})
+		idx = 0
+	default:
+		// Neither index nor ID: the fragment continues the call in flight
+		idx = len(calls) - 1
+	}
+
+	// Merge tool call data
+	if tc.ID != "" {
+		calls[idx].ID = tc.ID
+	}
+	if tc.Type != "" {
+		calls[idx].Type = tc.Type
 	}
+	if tc.Function.Name != "" {
+		calls[idx].Function.Name = tc.Function.Name
+	}
+	calls[idx].Function.Arguments += tc.Function.Arguments
+	return calls
+}
+
+// splitMalformedToolCalls separates tool calls whose arguments are not valid
+// JSON, returning the valid calls and the names of the malformed ones.
+// Empty arguments are valid.
+func splitMalformedToolCalls(calls []openai.ToolCall) ([]openai.ToolCall, []string) {
+	var valid []openai.ToolCall
+	var malformed []string
+	for _, tc := range calls {
+		if tc.Function.Arguments != "" && !json.Valid([]byte(tc.Function.Arguments)) {
+			malformed = append(malformed, tc.Function.Name)
+			continue
+		}
+		valid = append(valid, tc)
+	}
+	return valid, malformed
+}
+
+// decodeArgs parses a tool call's JSON arguments. Undecodable arguments yield
+// nil. With UseNumberArgs, numbers are kept as json.Number so large integers
+// aren't rounded through float64.
+func (m *OpenRouterModel) decodeArgs(raw string) map[string]any {
+	if raw == "" {
+		return nil
+	}
+	var args map[string]any
+	if !m.cfg.UseNumberArgs {
+		_ = json.Unmarshal([]byte(raw), &args)
+		return args
+	}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&args); err != nil {
+		return nil
+	}
+	return args
+}
+
+// functionCallPart converts a function call to a genai function-call part.
+// Some providers omit the call ID, so a synthetic one is assigned; the tool
+// response echoes it back.
+func (m *OpenRouterModel) functionCallPart(id string, fn openai.FunctionCall) *genai.Part {
+	args := m.decodeArgs(fn.Arguments)
+	if args == nil {
+		// Argument-less calls (empty or "null") still get a map
+		args = map[string]any{}
+	}
+	part := genai.NewPartFromFunctionCall(fn.Name, args)
+	if id == "" {
+		id = newToolCallID()
+	}
+	part.FunctionCall.ID = id
+	return part
 }
 
 // convertResponse converts an OpenAI ChatCompletionMessage to an ADK LLMResponse.
 func (m *OpenRouterModel) convertResponse(msg *openai.ChatCompletionMessage) *model.LLMResponse {
 	var parts []*genai.Part
 
-	// Add text content
-	if msg.Content != "" {
-		parts = append(parts, genai.NewPartFromText(msg.Content))
+	// Add reasoning as a thought part ahead of the answer
+	if msg.ReasoningContent != "" {
+		parts = append(parts, &genai.Part{Text: msg.ReasoningContent, Thought: true})
+	}
+
+	// Add text content. Some upstreams send content as an array of parts,
+	// which go-openai decodes into MultiContent; its text is joined.
+	text := msg.Content
+	if text == "" {
+		text = multiContentText(msg.MultiContent)
+	}
+	if text != "" {
+		parts = append(parts, genai.NewPartFromText(text))
 	}
 
 	// Add function calls
 	for _, tc := range msg.ToolCalls {
 		if tc.Type == openai.ToolTypeFunction {
-			var args map[string]any
-			if tc.Function.Arguments != "" {
-				_ = json.Unmarshal([]byte(tc.Function.Arguments), &args)
-			}
-			parts = append(parts, genai.NewPartFromFunctionCall(tc.Function.Name, args))
-			// Set the ID on the function call
-			if len(parts) > 0 && parts[len(parts)-1].FunctionCall != nil {
-				parts[len(parts)-1].FunctionCall.ID = tc.ID
-			}
+			parts = append(parts, m.functionCallPart(tc.ID, tc.Function))
 		}
 	}
+	// Older providers return a single legacy function_call instead
+	if msg.FunctionCall != nil && msg.FunctionCall.Name != "" && len(msg.ToolCalls) == 0 {
+		parts = append(parts, m.functionCallPart("", *msg.FunctionCall))
+	}
 
 	content := &genai.Content{
 		Role:  "model",
@@ -340,25 +1302,51 @@ func (m *OpenRouterModel) convertResponse(msg *openai.ChatCompletionMessage) *mo
 
 // Helper functions
 
-// convertRole converts ADK role to OpenAI role.
+// multiContentText concatenates the text segments of array-form content.
+func multiContentText(parts []openai.ChatMessagePart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == openai.ChatMessagePartTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return joinStrings(texts)
+}
+
+// newToolCallID returns a random ID for a tool call the provider left unnamed.
+func newToolCallID() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return "call_" + hex.EncodeToString(b[:])
+}
+
+// convertRole converts ADK role to OpenAI role, ignoring case. Unknown roles
+// map to user.
 func convertRole(role string) string {
-	switch role {
+	switch strings.ToLower(role) {
 	case "model", "assistant":
 		return openai.ChatMessageRoleAssistant
 	case "system":
 		return openai.ChatMessageRoleSystem
-	case "tool":
+	case "tool", "function":
+		// "function" is the legacy role of tool responses
 		return openai.ChatMessageRoleTool
 	default:
 		return openai.ChatMessageRoleUser
 	}
 }
 
-// convertFunctionDeclaration converts a genai.FunctionDeclaration to an OpenAI Tool.
-func convertFunctionDeclaration(fn *genai.FunctionDeclaration) openai.Tool {
+// convertFunctionDeclaration converts a genai.FunctionDeclaration to an OpenAI
+// Tool. Parameter schemas nested deeper than maxDepth are rejected (see
+// convertSchema).
+func convertFunctionDeclaration(fn *genai.FunctionDeclaration, maxDepth int) (openai.Tool, error) {
 	var params any
 	if fn.Parameters != nil {
-		params = convertSchema(fn.Parameters)
+		schema, err := convertSchema(fn.Parameters, maxDepth)
+		if err != nil {
+			return openai.Tool{}, fmt.Errorf("invalid parameters for function %q: %w", fn.Name, err)
+		}
+		params = schema
 	} else if fn.ParametersJsonSchema != nil {
 		params = fn.ParametersJsonSchema
 	}
@@ -370,15 +1358,119 @@ func convertFunctionDeclaration(fn *genai.FunctionDeclaration) openai.Tool {
 			Description: fn.Description,
 			Parameters:  params,
 		},
+	}, nil
+}
+
+// makeStrict marks def for strict schema adherence. Strict mode requires
+// additionalProperties:false on every object and every property to be
+// required, so converted schemas are closed and their optional properties
+// made nullable; a ParametersJsonSchema is sent as given and must already
+// comply.
+func makeStrict(def *openai.FunctionDefinition, fn *genai.FunctionDeclaration) {
+	def.Strict = true
+	switch {
+	case fn.Parameters != nil:
+		schema := def.Parameters.(map[string]any)
+		closeObjectSchemas(schema)
+		requireAllProperties(schema)
+	case fn.ParametersJsonSchema == nil:
+		// Strict mode needs a parameters object even for a function without arguments
+		def.Parameters = map[string]any{
+			"type":                 "object",
+			"properties":           map[string]any{},
+			"additionalProperties": false,
+		}
+	}
+}
+
+// closeObjectSchemas sets additionalProperties:false on every object schema
+// within a converted schema. The type is matched without regard to case, so
+// genai's upper-case constants are recognised too.
+func closeObjectSchemas(schema map[string]any) {
+	if typ, _ := schema["type"].(string); strings.EqualFold(typ, string(genai.TypeObject)) {
+		schema["additionalProperties"] = false
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		closeObjectSchemas(items)
+	}
+	if props, ok := schema["properties"].(schemaProperties); ok {
+		for _, prop := range props {
+			closeObjectSchemas(prop.Schema)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, sub := range anyOf {
+			if sub, ok := sub.(map[string]any); ok {
+				closeObjectSchemas(sub)
+			}
+		}
 	}
 }
 
-// convertSchema converts a genai.Schema to a map for OpenAI.
-func convertSchema(schema *genai.Schema) map[string]any {
+// requireAllProperties rewrites a converted schema for strict mode, which
+// requires every property of every object to be listed in required. Each
+// optional property is made nullable instead, so the model can still leave
+// it out by sending null.
+func requireAllProperties(schema map[string]any) {
+	if items, ok := schema["items"].(map[string]any); ok {
+		requireAllProperties(items)
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, sub := range anyOf {
+			if sub, ok := sub.(map[string]any); ok {
+				requireAllProperties(sub)
+			}
+		}
+	}
+	props, ok := schema["properties"].(schemaProperties)
+	if !ok {
+		return
+	}
+	required, _ := schema["required"].([]string)
+	names := make([]string, 0, len(props))
+	for i, prop := range props {
+		requireAllProperties(prop.Schema)
+		if !slices.Contains(required, prop.Name) {
+			props[i].Schema = nullable(prop.Schema)
+		}
+		names = append(names, prop.Name)
+	}
+	schema["required"] = names
+}
+
+// nullable returns schema widened to also accept null.
+func nullable(schema map[string]any) map[string]any {
+	null := map[string]any{"type": "null"}
+	if anyOf, ok := schema["anyOf"].([]any); ok && len(schema) == 1 {
+		return map[string]any{"anyOf": append(slices.Clone(anyOf), null)}
+	}
+	return map[string]any{"anyOf": []any{schema, null}}
+}
+
+// defaultMaxSchemaDepth is the schema nesting limit used when MaxSchemaDepth
+// is not set.
+const defaultMaxSchemaDepth = 50
+
+// convertSchema converts a genai.Schema to a map for OpenAI. Schemas nested
+// more than maxDepth levels deep (defaultMaxSchemaDepth when maxDepth is 0),
+// including self-referencing ones, are rejected with an error rather than
+// recursing without bound.
+func convertSchema(schema *genai.Schema, maxDepth int) (map[string]any, error) {
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxSchemaDepth
+	}
+	return convertSchemaAt(schema, 1, maxDepth)
+}
+
+// convertSchemaAt converts schema found at the given nesting depth.
+func convertSchemaAt(schema *genai.Schema, depth, maxDepth int) (map[string]any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("schema nesting exceeds the maximum depth of %d", maxDepth)
+	}
 	result := make(map[string]any)
 
 	if schema.Type != "" {
-		result["type"] = string(schema.Type)
+		result["type"] = normalizeSchemaType(schema.Type)
 	}
 	if schema.Description != "" {
 		result["description"] = schema.Description
@@ -386,46 +1478,307 @@ func convertSchema(schema *genai.Schema) map[string]any {
 	if len(schema.Enum) > 0 {
 		result["enum"] = schema.Enum
 	}
+	// Default is an interface, so a zero value such as "" or false is still
+	// an explicit default; only a nil Default means none was set.
+	if schema.Default != nil {
+		result["default"] = schema.Default
+	}
 	if schema.Items != nil {
-		result["items"] = convertSchema(schema.Items)
+		items, err := convertSchemaAt(schema.Items, depth+1, maxDepth)
+		if err != nil {
+			return nil, err
+		}
+		result["items"] = items
 	}
 	if len(schema.Properties) > 0 {
-		props := make(map[string]any)
-		for name, prop := range schema.Properties {
-			props[name] = convertSchema(prop)
+		props := make(schemaProperties, 0, len(schema.Properties))
+		for _, name := range propertyOrder(schema) {
+			prop, err := convertSchemaAt(schema.Properties[name], depth+1, maxDepth)
+			if err != nil {
+				return nil, err
+			}
+			props = append(props, schemaProperty{Name: name, Schema: prop})
 		}
 		result["properties"] = props
 	}
 	if len(schema.Required) > 0 {
 		result["required"] = schema.Required
 	}
+	if len(schema.AnyOf) > 0 {
+		anyOf := make([]any, 0, len(schema.AnyOf))
+		for _, sub := range schema.AnyOf {
+			converted, err := convertSchemaAt(sub, depth+1, maxDepth)
+			if err != nil {
+				return nil, err
+			}
+			anyOf = append(anyOf, converted)
+		}
+		result["anyOf"] = anyOf
+	}
 
-	return result
+	return result, nil
+}
+
+// schemaTypeAliases maps common non-JSON Schema type names to their JSON
+// Schema equivalents.
+var schemaTypeAliases = map[string]string{
+	"int":     "integer",
+	"int32":   "integer",
+	"int64":   "integer",
+	"long":    "integer",
+	"float":   "number",
+	"float32": "number",
+	"float64": "number",
+	"double":  "number",
+	"decimal": "number",
+	"bool":    "boolean",
+	"str":     "string",
+	"list":    "array",
+	"dict":    "object",
+	"map":     "object",
+}
+
+// normalizeSchemaType returns the JSON Schema name for t. genai's own
+// upper-case constants, such as genai.TypeObject, are lower-cased and common
+// aliases such as "int" or "double" are mapped; other names pass through.
+func normalizeSchemaType(t genai.Type) string {
+	name := strings.ToLower(strings.TrimSpace(string(t)))
+	if alias, ok := schemaTypeAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// schemaProperty is a single named property of a converted object schema.
+type schemaProperty struct {
+	Name   string
+	Schema map[string]any
 }
 
-// convertFinishReason converts OpenAI finish reason to genai.FinishReason.
+// schemaProperties holds converted object properties in a fixed order and
+// marshals them as a JSON object, keeping request bodies deterministic.
+type schemaProperties []schemaProperty
+
+// MarshalJSON writes the properties as a JSON object in slice order.
+func (p schemaProperties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(prop.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(prop.Schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// propertyOrder returns the property names of schema in emission order:
+// names listed in PropertyOrdering first, then any remaining names sorted.
+func propertyOrder(schema *genai.Schema) []string {
+	names := make([]string, 0, len(schema.Properties))
+	seen := make(map[string]bool, len(schema.Properties))
+	for _, name := range schema.PropertyOrdering {
+		if _, ok := schema.Properties[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+
+	var rest []string
+	for name := range schema.Properties {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(names, rest...)
+}
+
+// convertUsage converts OpenAI token usage to genai usage metadata, or
+// returns nil when the provider reported no usage.
+func convertUsage(usage openai.Usage) *genai.GenerateContentResponseUsageMetadata {
+	if usage.TotalTokens <= 0 {
+		return nil
+	}
+	return &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:     int32(usage.PromptTokens),
+		CandidatesTokenCount: int32(usage.CompletionTokens),
+		TotalTokenCount:      int32(usage.TotalTokens),
+	}
+}
+
+// mergeUsage combines usage reported on several chunks of one stream. Some
+// providers send running counts mid-stream, and the last chunk may carry
+// fewer fields than an earlier one, so each count keeps its largest value.
+func mergeUsage(acc, next openai.Usage) openai.Usage {
+	acc.PromptTokens = max(acc.PromptTokens, next.PromptTokens)
+	acc.CompletionTokens = max(acc.CompletionTokens, next.CompletionTokens)
+	acc.TotalTokens = max(acc.TotalTokens, next.TotalTokens)
+	if next.PromptTokensDetails != nil {
+		acc.PromptTokensDetails = next.PromptTokensDetails
+	}
+	if next.CompletionTokensDetails != nil {
+		acc.CompletionTokensDetails = next.CompletionTokensDetails
+	}
+	return acc
+}
+
+// CostMetadataKey is the LLMResponse.CustomMetadata key holding the call's
+// cost in OpenRouter credits, present when IncludeCost is enabled.
+const CostMetadataKey = "openrouter_cost"
+
+// ResponseCost returns the OpenRouter cost recorded on resp, if any.
+func ResponseCost(resp *model.LLMResponse) (float64, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	cost, ok := resp.CustomMetadata[CostMetadataKey].(float64)
+	return cost, ok
+}
+
+// CancelledErrorCode is the ErrorCode of the partial response yielded with
+// PartialOnCancel when a stream is cancelled.
+const CancelledErrorCode = "CANCELLED"
+
+// GenerationIDMetadataKey is the LLMResponse.CustomMetadata key holding the
+// OpenRouter generation ID of the call, for log correlation and support.
+const GenerationIDMetadataKey = "openrouter_generation_id"
+
+// ResponseGenerationID returns the OpenRouter generation ID recorded on resp,
+// if any.
+func ResponseGenerationID(resp *model.LLMResponse) (string, bool) {
+	if resp == nil {
+		return "", false
+	}
+	id, ok := resp.CustomMetadata[GenerationIDMetadataKey].(string)
+	return id, ok
+}
+
+// LastGenerationID returns the generation ID of the most recently completed
+// call, or "" if none has reported one. With concurrent calls it is the ID of
+// whichever finished last; use ResponseGenerationID to tie an ID to a response.
+func (m *OpenRouterModel) LastGenerationID() string {
+	if id := m.lastGenerationID.Load(); id != nil {
+		return *id
+	}
+	return ""
+}
+
+// recordGenerationID attaches id to the final response and remembers it as
+// the last generation ID.
+func (m *OpenRouterModel) recordGenerationID(resp *model.LLMResponse, id string) {
+	if id == "" {
+		return
+	}
+	if resp.CustomMetadata == nil {
+		resp.CustomMetadata = make(map[string]any)
+	}
+	resp.CustomMetadata[GenerationIDMetadataKey] = id
+	m.lastGenerationID.Store(&id)
+}
+
+// IsTruncated reports whether resp was cut off by the output token limit, in
+// which case the model may be asked to continue where it stopped.
+func IsTruncated(resp *model.LLMResponse) bool {
+	return resp != nil && resp.FinishReason == genai.FinishReasonMaxTokens
+}
+
+// attachCallMetadata copies data captured by the transport for this call
+// onto the final response.
+func (m *OpenRouterModel) attachCallMetadata(ctx context.Context, resp *model.LLMResponse) {
+	state := callStateFrom(ctx)
+	if state == nil {
+		return
+	}
+	if state.cost != nil {
+		if resp.CustomMetadata == nil {
+			resp.CustomMetadata = make(map[string]any)
+		}
+		resp.CustomMetadata[CostMetadataKey] = *state.cost
+	}
+	if len(state.citations) > 0 {
+		resp.CitationMetadata = &genai.CitationMetadata{Citations: state.citations}
+	}
+	if state.audio != nil && resp.Content != nil {
+		format := ""
+		if m.cfg.Audio != nil {
+			format = m.cfg.Audio.Format
+		}
+		state.audio.attach(resp.Content, format)
+	}
+}
+
+// finishReasons maps OpenRouter finish reasons to genai ones. Besides the
+// OpenAI values it covers the native reasons some providers pass through.
+var finishReasons = map[openai.FinishReason]genai.FinishReason{
+	openai.FinishReasonStop:          genai.FinishReasonStop,
+	openai.FinishReasonLength:        genai.FinishReasonMaxTokens,
+	openai.FinishReasonToolCalls:     genai.FinishReasonStop, // Tool calls are considered a valid stop
+	openai.FinishReasonFunctionCall:  genai.FinishReasonStop,
+	openai.FinishReasonContentFilter: genai.FinishReasonSafety,
+	"tool_use":                       genai.FinishReasonStop,
+	"end_turn":                       genai.FinishReasonStop,
+	"stop_sequence":                  genai.FinishReasonStop,
+	"max_tokens":                     genai.FinishReasonMaxTokens,
+	"error":                          genai.FinishReasonOther,
+}
+
+// convertFinishReason converts an OpenAI finish reason to a genai one.
+// Unknown reasons map to FinishReasonUnspecified.
 func convertFinishReason(reason openai.FinishReason) genai.FinishReason {
-	switch reason {
-	case openai.FinishReasonStop:
-		return genai.FinishReasonStop
-	case openai.FinishReasonLength:
-		return genai.FinishReasonMaxTokens
-	case openai.FinishReasonToolCalls, openai.FinishReasonFunctionCall:
-		return genai.FinishReasonStop // Tool calls are considered a valid stop
-	default:
-		return genai.FinishReasonUnspecified
+	if mapped, ok := finishReasons[reason]; ok {
+		return mapped
+	}
+	return genai.FinishReasonUnspecified
+}
+
+// finishReason converts a finish reason, consulting the configured
+// FinishReasons first. Unknown reasons are logged so new values don't go
+// unnoticed.
+func (m *OpenRouterModel) finishReason(reason openai.FinishReason) genai.FinishReason {
+	if mapped, ok := m.cfg.FinishReasons[string(reason)]; ok {
+		return mapped
 	}
+	if _, ok := finishReasons[reason]; !ok && reason != "" {
+		m.logWarn("openrouter unknown finish reason", slog.String("finish_reason", string(reason)))
+	}
+	return convertFinishReason(reason)
 }
 
-// extractText extracts all text from a genai.Content.
-func extractText(content *genai.Content) string {
+// extractText extracts all text from a genai.Content, joining the non-empty
+// parts with sep. System instructions use "\n" so separate instructions don't
+// run together.
+func extractText(content *genai.Content, sep string) string {
 	var texts []string
 	for _, part := range content.Parts {
 		if part.Text != "" {
 			texts = append(texts, part.Text)
 		}
 	}
-	return joinStrings(texts)
+	return strings.Join(texts, sep)
+}
+
+// joinNonEmpty joins the non-empty strings in strs with sep.
+func joinNonEmpty(strs []string, sep string) string {
+	var nonEmpty []string
+	for _, s := range strs {
+		if s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
 }
 
 // joinStrings joins strings with no separator.
@@ -436,3 +1789,26 @@ func joinStrings(strs []string) string {
 	}
 	return result
 }
+
+// canonicalJSON marshals v with object keys sorted at every level, including
+// inside embedded json.RawMessage values, and without HTML escaping, so equal
+// values always produce identical bytes. Numbers are kept as written.
+func canonicalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var decoded any
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(decoded); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -1,6 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/sashabaranov/go-openai"
@@ -69,6 +77,56 @@ func TestNewOpenRouterModel_EmptyAPIKey(t *testing.T) {
 	}
 }
 
+func TestNewOpenRouterModel_StrictModelName(t *testing.T) {
+	tests := []struct {
+		name      string
+		modelName string
+		wantErr   bool
+	}{
+		{"provider and model", "openai/gpt-4", false},
+		{"with variant suffix", "meta-llama/llama-3.1-8b-instruct:free", false},
+		{"missing provider", "gpt-4", true},
+		{"empty provider", "/gpt-4", true},
+		{"empty model", "openai/", true},
+		{"too many segments", "openai/gpt-4/turbo", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := NewOpenRouterModel(tt.modelName, &OpenRouterConfig{
+				APIKey:          "test-api-key",
+				StrictModelName: true,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for model name %q", tt.modelName)
+				}
+				if model != nil {
+					t.Error("expected model to be nil on error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error for %q, got %v", tt.modelName, err)
+			}
+		})
+	}
+}
+
+func TestNewOpenRouterModel_FreeFormModelName(t *testing.T) {
+	model, err := NewOpenRouterModel("gpt-4", &OpenRouterConfig{
+		APIKey: "test-api-key",
+	})
+
+	if err != nil {
+		t.Fatalf("expected free-form name to be accepted without StrictModelName, got %v", err)
+	}
+	if model.modelName != "gpt-4" {
+		t.Errorf("expected model name 'gpt-4', got %q", model.modelName)
+	}
+}
+
 // ============================================================================
 // Name() Tests
 // ============================================================================
@@ -94,6 +152,23 @@ func TestName(t *testing.T) {
 	}
 }
 
+// ============================================================================
+// Client() Tests
+// ============================================================================
+
+func TestClient(t *testing.T) {
+	model, err := NewOpenRouterModel("openai/gpt-4", &OpenRouterConfig{
+		APIKey: "test-api-key",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if model.Client() == nil {
+		t.Error("expected Client() to be non-nil after construction")
+	}
+}
+
 // ============================================================================
 // convertRole Tests
 // ============================================================================
@@ -108,9 +183,16 @@ func TestConvertRole(t *testing.T) {
 		{"assistant", openai.ChatMessageRoleAssistant},
 		{"system", openai.ChatMessageRoleSystem},
 		{"tool", openai.ChatMessageRoleTool},
+		{"function", openai.ChatMessageRoleTool},
 		{"unknown", openai.ChatMessageRoleUser},
 		{"", openai.ChatMessageRoleUser},
-		{"USER", openai.ChatMessageRoleUser}, // case sensitive - defaults to user
+		{"USER", openai.ChatMessageRoleUser},
+		{"Model", openai.ChatMessageRoleAssistant},
+		{"Assistant", openai.ChatMessageRoleAssistant},
+		{"SYSTEM", openai.ChatMessageRoleSystem},
+		{"TOOL", openai.ChatMessageRoleTool},
+		{"Function", openai.ChatMessageRoleTool},
+		{"Unknown", openai.ChatMessageRoleUser},
 	}
 
 	for _, tt := range tests {
@@ -137,6 +219,11 @@ func TestConvertFinishReason(t *testing.T) {
 		{"length", openai.FinishReasonLength, genai.FinishReasonMaxTokens},
 		{"tool_calls", openai.FinishReasonToolCalls, genai.FinishReasonStop},
 		{"function_call", openai.FinishReasonFunctionCall, genai.FinishReasonStop},
+		{"content_filter", openai.FinishReasonContentFilter, genai.FinishReasonSafety},
+		{"tool_use", openai.FinishReason("tool_use"), genai.FinishReasonStop},
+		{"end_turn", openai.FinishReason("end_turn"), genai.FinishReasonStop},
+		{"max_tokens", openai.FinishReason("max_tokens"), genai.FinishReasonMaxTokens},
+		{"error", openai.FinishReason("error"), genai.FinishReasonOther},
 		{"unknown", openai.FinishReason("unknown"), genai.FinishReasonUnspecified},
 		{"empty", openai.FinishReason(""), genai.FinishReasonUnspecified},
 	}
@@ -151,6 +238,41 @@ func TestConvertFinishReason(t *testing.T) {
 	}
 }
 
+func TestFinishReason_LogsUnknown(t *testing.T) {
+	var buf bytes.Buffer
+	m := &OpenRouterModel{cfg: OpenRouterConfig{Logger: slog.New(slog.NewTextHandler(&buf, nil))}}
+
+	if got := m.finishReason("stop"); got != genai.FinishReasonStop {
+		t.Errorf("expected STOP, got %v", got)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no log for a known reason, got %q", buf.String())
+	}
+
+	if got := m.finishReason("rate_limited"); got != genai.FinishReasonUnspecified {
+		t.Errorf("expected an unknown reason to map to unspecified, got %v", got)
+	}
+	if out := buf.String(); !strings.Contains(out, "level=WARN") || !strings.Contains(out, "finish_reason=rate_limited") {
+		t.Errorf("expected a warning naming the unknown reason, got %q", out)
+	}
+}
+
+func TestFinishReason_Configured(t *testing.T) {
+	m := &OpenRouterModel{}
+	WithFinishReason("rate_limited", genai.FinishReasonOther).apply(&m.cfg)
+	WithFinishReason("content_filter", genai.FinishReasonProhibitedContent).apply(&m.cfg)
+
+	if got := m.finishReason("rate_limited"); got != genai.FinishReasonOther {
+		t.Errorf("expected the added mapping, got %v", got)
+	}
+	if got := m.finishReason("content_filter"); got != genai.FinishReasonProhibitedContent {
+		t.Errorf("expected the override to win, got %v", got)
+	}
+	if got := m.finishReason("length"); got != genai.FinishReasonMaxTokens {
+		t.Errorf("expected built-in mappings to remain, got %v", got)
+	}
+}
+
 // ============================================================================
 // joinStrings Tests
 // ============================================================================
@@ -233,7 +355,7 @@ func TestExtractText(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := extractText(tt.content)
+			result := extractText(tt.content, "")
 			if result != tt.expected {
 				t.Errorf("extractText() = %q, want %q", result, tt.expected)
 			}
@@ -241,17 +363,99 @@ func TestExtractText(t *testing.T) {
 	}
 }
 
+func TestExtractText_Separator(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  *genai.Content
+		expected string
+	}{
+		{
+			name:     "single part",
+			content:  genai.NewContentFromText("Be concise.", "system"),
+			expected: "Be concise.",
+		},
+		{
+			name: "multiple parts",
+			content: &genai.Content{
+				Parts: []*genai.Part{
+					genai.NewPartFromText("Be concise."),
+					genai.NewPartFromText("Answer in English."),
+				},
+			},
+			expected: "Be concise.\nAnswer in English.",
+		},
+		{
+			name: "empty parts skipped",
+			content: &genai.Content{
+				Parts: []*genai.Part{
+					genai.NewPartFromText("Be concise."),
+					{},
+					genai.NewPartFromText("Answer in English."),
+				},
+			},
+			expected: "Be concise.\nAnswer in English.",
+		},
+		{
+			name:     "nil parts",
+			content:  &genai.Content{},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := extractText(tt.content, "\n")
+			if result != tt.expected {
+				t.Errorf("extractText(\\n) = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
 // ============================================================================
 // convertSchema Tests
 // ============================================================================
 
+// mustConvertSchema converts schema with the default depth limit, failing the
+// test on error.
+func mustConvertSchema(t *testing.T, schema *genai.Schema) map[string]any {
+	t.Helper()
+	result, err := convertSchema(schema, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return result
+}
+
+// propertySchema returns the converted schema of the named property of
+// schema, or nil if absent.
+func propertySchema(schema map[string]any, name string) map[string]any {
+	for _, prop := range schema["properties"].(schemaProperties) {
+		if prop.Name == name {
+			return prop.Schema
+		}
+	}
+	return nil
+}
+
+// mustConvertFunctionDeclaration converts fn with the default depth limit,
+// failing the test on error.
+func mustConvertFunctionDeclaration(t *testing.T, fn *genai.FunctionDeclaration) openai.Tool {
+	t.Helper()
+	tool, err := convertFunctionDeclaration(fn, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return tool
+}
+
 func TestConvertSchema_Simple(t *testing.T) {
 	schema := &genai.Schema{
 		Type:        "string",
 		Description: "A simple string",
 	}
 
-	result := convertSchema(schema)
+	result := mustConvertSchema(t, schema)
 
 	if result["type"] != "string" {
 		t.Errorf("expected type 'string', got %v", result["type"])
@@ -267,7 +471,7 @@ func TestConvertSchema_WithEnum(t *testing.T) {
 		Enum: []string{"celsius", "fahrenheit"},
 	}
 
-	result := convertSchema(schema)
+	result := mustConvertSchema(t, schema)
 
 	enum, ok := result["enum"].([]string)
 	if !ok {
@@ -278,6 +482,104 @@ func TestConvertSchema_WithEnum(t *testing.T) {
 	}
 }
 
+func TestConvertSchema_WithDefault(t *testing.T) {
+	schema := &genai.Schema{
+		Type: "object",
+		Properties: map[string]*genai.Schema{
+			"units": {
+				Type:    "string",
+				Default: "celsius",
+			},
+		},
+	}
+
+	result := mustConvertSchema(t, schema)
+
+	units := propertySchema(result, "units")
+	if units["default"] != "celsius" {
+		t.Errorf("expected default 'celsius', got %v", units["default"])
+	}
+}
+
+func TestConvertSchema_ZeroValueDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   *genai.Schema
+		expected any
+	}{
+		{"empty string", &genai.Schema{Type: "string", Default: ""}, ""},
+		{"false", &genai.Schema{Type: "boolean", Default: false}, false},
+		{"zero", &genai.Schema{Type: "integer", Default: 0}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := mustConvertSchema(t, tt.schema)
+			got, ok := result["default"]
+			if !ok {
+				t.Fatal("expected explicit zero-valued default to be preserved")
+			}
+			if got != tt.expected {
+				t.Errorf("expected default %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConvertSchema_NormalizesTypes(t *testing.T) {
+	tests := []struct {
+		in   genai.Type
+		want string
+	}{
+		{"int", "integer"},
+		{"int64", "integer"},
+		{"float", "number"},
+		{"double", "number"},
+		{"bool", "boolean"},
+		{genai.TypeObject, "object"},
+		{genai.TypeInteger, "integer"},
+		{"Number", "number"},
+		{"string", "string"},
+		{"null", "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.in), func(t *testing.T) {
+			result := mustConvertSchema(t, &genai.Schema{Type: tt.in})
+			if result["type"] != tt.want {
+				t.Errorf("expected type %q, got %v", tt.want, result["type"])
+			}
+		})
+	}
+}
+
+func TestConvertSchema_NormalizesNestedTypes(t *testing.T) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"scores": {Type: "list", Items: &genai.Schema{Type: "float"}},
+		},
+	}
+
+	data, err := json.Marshal(mustConvertSchema(t, schema))
+	if err != nil {
+		t.Fatalf("failed to marshal schema: %v", err)
+	}
+
+	want := `{"properties":{"scores":{"items":{"type":"number"},"type":"array"}},"type":"object"}`
+	if string(data) != want {
+		t.Errorf("unexpected schema\n got: %s\nwant: %s", data, want)
+	}
+}
+
+func TestConvertSchema_NoDefault(t *testing.T) {
+	result := mustConvertSchema(t, &genai.Schema{Type: "string"})
+
+	if _, ok := result["default"]; ok {
+		t.Errorf("expected no default key, got %v", result["default"])
+	}
+}
+
 func TestConvertSchema_Object(t *testing.T) {
 	schema := &genai.Schema{
 		Type:        "object",
@@ -295,15 +597,15 @@ func TestConvertSchema_Object(t *testing.T) {
 		Required: []string{"city"},
 	}
 
-	result := convertSchema(schema)
+	result := mustConvertSchema(t, schema)
 
 	if result["type"] != "object" {
 		t.Errorf("expected type 'object', got %v", result["type"])
 	}
 
-	props, ok := result["properties"].(map[string]any)
+	props, ok := result["properties"].(schemaProperties)
 	if !ok {
-		t.Fatalf("expected properties to be map[string]any, got %T", result["properties"])
+		t.Fatalf("expected properties to be schemaProperties, got %T", result["properties"])
 	}
 	if len(props) != 2 {
 		t.Errorf("expected 2 properties, got %d", len(props))
@@ -318,6 +620,58 @@ func TestConvertSchema_Object(t *testing.T) {
 	}
 }
 
+func TestConvertSchema_Deterministic(t *testing.T) {
+	schema := &genai.Schema{
+		Type: "object",
+		Properties: map[string]*genai.Schema{
+			"city":    {Type: "string"},
+			"country": {Type: "string"},
+			"units":   {Type: "string"},
+			"days":    {Type: "integer"},
+			"hourly":  {Type: "boolean"},
+		},
+	}
+
+	first, err := json.Marshal(mustConvertSchema(t, schema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := json.Marshal(mustConvertSchema(t, schema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected identical JSON, got\n%s\n%s", first, second)
+	}
+	want := `{"properties":{"city":{"type":"string"},"country":{"type":"string"},"days":{"type":"integer"},"hourly":{"type":"boolean"},"units":{"type":"string"}},"type":"object"}`
+	if string(first) != want {
+		t.Errorf("expected sorted properties\n got: %s\nwant: %s", first, want)
+	}
+}
+
+func TestConvertSchema_PropertyOrdering(t *testing.T) {
+	schema := &genai.Schema{
+		Type: "object",
+		Properties: map[string]*genai.Schema{
+			"alpha": {Type: "string"},
+			"beta":  {Type: "string"},
+			"zeta":  {Type: "string"},
+		},
+		PropertyOrdering: []string{"zeta", "alpha"},
+	}
+
+	data, err := json.Marshal(mustConvertSchema(t, schema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"properties":{"zeta":{"type":"string"},"alpha":{"type":"string"},"beta":{"type":"string"}},"type":"object"}`
+	if string(data) != want {
+		t.Errorf("unexpected property order\n got: %s\nwant: %s", data, want)
+	}
+}
+
 func TestConvertSchema_Array(t *testing.T) {
 	schema := &genai.Schema{
 		Type: "array",
@@ -326,7 +680,7 @@ func TestConvertSchema_Array(t *testing.T) {
 		},
 	}
 
-	result := convertSchema(schema)
+	result := mustConvertSchema(t, schema)
 
 	if result["type"] != "array" {
 		t.Errorf("expected type 'array', got %v", result["type"])
@@ -341,16 +695,188 @@ func TestConvertSchema_Array(t *testing.T) {
 	}
 }
 
+func TestConvertSchema_ArrayOfObjectsWithRequired(t *testing.T) {
+	schema := &genai.Schema{
+		Type: "object",
+		Properties: map[string]*genai.Schema{
+			"orders": {
+				Type: "array",
+				Items: &genai.Schema{
+					Type: "object",
+					Properties: map[string]*genai.Schema{
+						"id": {Type: "string"},
+						"lines": {
+							Type: "array",
+							Items: &genai.Schema{
+								Type: "object",
+								Properties: map[string]*genai.Schema{
+									"sku":      {Type: "string"},
+									"quantity": {Type: "integer"},
+									"note":     {Type: "string"},
+								},
+								Required: []string{"sku", "quantity"},
+							},
+						},
+					},
+					Required: []string{"id", "lines"},
+				},
+			},
+		},
+		Required: []string{"orders"},
+	}
+
+	data, err := json.Marshal(mustConvertSchema(t, schema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"properties":{"orders":{"items":{"properties":{` +
+		`"id":{"type":"string"},` +
+		`"lines":{"items":{"properties":{"note":{"type":"string"},"quantity":{"type":"integer"},"sku":{"type":"string"}},"required":["sku","quantity"],"type":"object"},"type":"array"}},` +
+		`"required":["id","lines"],"type":"object"},"type":"array"}},"required":["orders"],"type":"object"}`
+	if string(data) != want {
+		t.Errorf("unexpected nested schema\n got: %s\nwant: %s", data, want)
+	}
+}
+
+// nestedSchema builds a chain of depth object schemas, each holding the next
+// as its "child" property.
+func nestedSchema(depth int) *genai.Schema {
+	schema := &genai.Schema{Type: "string"}
+	for range depth - 1 {
+		schema = &genai.Schema{Type: "object", Properties: map[string]*genai.Schema{"child": schema}}
+	}
+	return schema
+}
+
+func TestConvertSchema_DepthLimit(t *testing.T) {
+	if _, err := convertSchema(nestedSchema(defaultMaxSchemaDepth), 0); err != nil {
+		t.Errorf("expected a schema at the default depth limit to convert, got %v", err)
+	}
+
+	_, err := convertSchema(nestedSchema(defaultMaxSchemaDepth+1), 0)
+	if err == nil || !strings.Contains(err.Error(), "maximum depth of 50") {
+		t.Errorf("expected a depth error past the default limit, got %v", err)
+	}
+
+	if _, err := convertSchema(nestedSchema(4), 3); err == nil {
+		t.Error("expected a depth error past a configured limit")
+	}
+}
+
+func TestConvertSchema_SelfReference(t *testing.T) {
+	node := &genai.Schema{Type: "object", Properties: map[string]*genai.Schema{}}
+	node.Properties["next"] = node
+	node.Items = node
+
+	_, err := convertSchema(node, 0)
+
+	if err == nil {
+		t.Fatal("expected a self-referencing schema to be rejected")
+	}
+}
+
+func TestConvertRequest_SchemaTooDeep(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxSchemaDepth: 5}}
+	req := userRequest("Hi")
+	req.Config = &genai.GenerateContentConfig{Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{
+		{Name: "deep", Parameters: nestedSchema(6)},
+	}}}}
+
+	_, err := m.convertRequest(req, m.modelName)
+
+	if err == nil || !strings.Contains(err.Error(), `function "deep"`) {
+		t.Errorf("expected a depth error naming the function, got %v", err)
+	}
+}
+
 func TestConvertSchema_Empty(t *testing.T) {
 	schema := &genai.Schema{}
 
-	result := convertSchema(schema)
+	result := mustConvertSchema(t, schema)
 
 	if len(result) != 0 {
 		t.Errorf("expected empty map for empty schema, got %v", result)
 	}
 }
 
+func TestConvertSchema_AnyOf(t *testing.T) {
+	schema := &genai.Schema{
+		Type: "object",
+		Properties: map[string]*genai.Schema{
+			"location": {
+				AnyOf: []*genai.Schema{
+					{Type: "string"},
+					{
+						Type: "object",
+						Properties: map[string]*genai.Schema{
+							"lat": {Type: "number"},
+							"lng": {Type: "number"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result := mustConvertSchema(t, schema)
+
+	location := propertySchema(result, "location")
+	if location == nil {
+		t.Fatal("expected location property to be present")
+	}
+	anyOf, ok := location["anyOf"].([]any)
+	if !ok {
+		t.Fatalf("expected anyOf to be []any, got %T", location["anyOf"])
+	}
+	if len(anyOf) != 2 {
+		t.Fatalf("expected 2 anyOf entries, got %d", len(anyOf))
+	}
+	if anyOf[0].(map[string]any)["type"] != "string" {
+		t.Errorf("expected first anyOf type 'string', got %v", anyOf[0])
+	}
+	second := anyOf[1].(map[string]any)
+	if second["type"] != "object" {
+		t.Errorf("expected second anyOf type 'object', got %v", second["type"])
+	}
+	if _, ok := second["properties"].(schemaProperties); !ok {
+		t.Errorf("expected second anyOf entry to have converted properties, got %v", second)
+	}
+}
+
+func TestConvertSchema_NestedAnyOf(t *testing.T) {
+	schema := &genai.Schema{
+		AnyOf: []*genai.Schema{
+			{Type: "null"},
+			{AnyOf: []*genai.Schema{{Type: "string"}, {Type: "integer"}}},
+		},
+	}
+
+	result := mustConvertSchema(t, schema)
+
+	anyOf := result["anyOf"].([]any)
+	nested, ok := anyOf[1].(map[string]any)["anyOf"].([]any)
+	if !ok {
+		t.Fatalf("expected nested anyOf to be []any, got %v", anyOf[1])
+	}
+	if len(nested) != 2 {
+		t.Errorf("expected 2 nested anyOf entries, got %d", len(nested))
+	}
+}
+
+func TestConvertSchema_EmptyAnyOf(t *testing.T) {
+	schema := &genai.Schema{
+		Type:  "string",
+		AnyOf: []*genai.Schema{},
+	}
+
+	result := mustConvertSchema(t, schema)
+
+	if _, ok := result["anyOf"]; ok {
+		t.Errorf("expected no anyOf key for empty AnyOf, got %v", result["anyOf"])
+	}
+}
+
 // ============================================================================
 // convertFunctionDeclaration Tests
 // ============================================================================
@@ -368,7 +894,7 @@ func TestConvertFunctionDeclaration(t *testing.T) {
 		},
 	}
 
-	result := convertFunctionDeclaration(fn)
+	result := mustConvertFunctionDeclaration(t, fn)
 
 	if result.Type != openai.ToolTypeFunction {
 		t.Errorf("expected type 'function', got %v", result.Type)
@@ -396,7 +922,7 @@ func TestConvertFunctionDeclaration_WithJsonSchema(t *testing.T) {
 		},
 	}
 
-	result := convertFunctionDeclaration(fn)
+	result := mustConvertFunctionDeclaration(t, fn)
 
 	if result.Function.Parameters == nil {
 		t.Error("expected parameters to be non-nil for JSON schema")
@@ -409,18 +935,286 @@ func TestConvertFunctionDeclaration_NoParameters(t *testing.T) {
 		Description: "Get current time",
 	}
 
-	result := convertFunctionDeclaration(fn)
+	result := mustConvertFunctionDeclaration(t, fn)
 
 	if result.Function.Parameters != nil {
 		t.Errorf("expected nil parameters, got %v", result.Function.Parameters)
 	}
 }
 
-// ============================================================================
-// convertContent Tests
-// ============================================================================
+// toolHistoryRequest builds a request where the model calls callID and a tool
+// response answers responseID.
+func toolHistoryRequest(callID, responseID string) *model.LLMRequest {
+	return &model.LLMRequest{Contents: []*genai.Content{
+		genai.NewContentFromText("What's the weather?", genai.RoleUser),
+		{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: callID, Name: "get_weather"}}}},
+		{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: responseID, Name: "get_weather", Response: map[string]any{"temp": 20}}}}},
+	}}
+}
 
-func TestConvertContent_TextMessage(t *testing.T) {
+func TestConvertRequest_ValidateToolCalls(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{ValidateToolCalls: true}}
+
+	if _, err := m.convertRequest(toolHistoryRequest("call_1", "call_1"), m.modelName); err != nil {
+		t.Errorf("expected matched tool call IDs to pass, got %v", err)
+	}
+
+	_, err := m.convertRequest(toolHistoryRequest("call_1", "call_2"), m.modelName)
+	if err == nil {
+		t.Fatal("expected an error for an orphaned tool response")
+	}
+	if !strings.Contains(err.Error(), `"call_2"`) || !strings.Contains(err.Error(), `"get_weather"`) {
+		t.Errorf("expected the error to name the orphaned call, got %v", err)
+	}
+}
+
+func TestConvertRequest_ToolResponseBeforeCall(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{ValidateToolCalls: true}}
+	req := toolHistoryRequest("call_1", "call_1")
+	req.Contents[1], req.Contents[2] = req.Contents[2], req.Contents[1]
+
+	if _, err := m.convertRequest(req, m.modelName); err == nil {
+		t.Error("expected an error for a tool response preceding its call")
+	}
+}
+
+func TestConvertRequest_ToolCallsNotValidatedByDefault(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+
+	if _, err := m.convertRequest(toolHistoryRequest("call_1", "call_2"), m.modelName); err != nil {
+		t.Errorf("expected no validation by default, got %v", err)
+	}
+}
+
+func TestConvertRequest_MaxMessages(t *testing.T) {
+	req := toolHistoryRequest("call_1", "call_1")
+
+	within := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxMessages: 3}}
+	if _, err := within.convertRequest(req, within.modelName); err != nil {
+		t.Errorf("expected 3 messages to pass a limit of 3, got %v", err)
+	}
+
+	over := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxMessages: 2}}
+	_, err := over.convertRequest(req, over.modelName)
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("expected ErrRequestTooLarge, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "3 messages") {
+		t.Errorf("expected the error to state the message count, got %v", err)
+	}
+}
+
+func TestConvertRequest_MaxRequestBytes(t *testing.T) {
+	req := userRequest(strings.Repeat("x", 2048))
+
+	within := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxRequestBytes: 4096}}
+	if _, err := within.convertRequest(req, within.modelName); err != nil {
+		t.Errorf("expected a small request to pass, got %v", err)
+	}
+
+	over := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxRequestBytes: 1024}}
+	if _, err := over.convertRequest(req, over.modelName); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("expected ErrRequestTooLarge, got %v", err)
+	}
+}
+
+func TestConvertRequest_StrictTools(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{StrictTools: true}}
+	req := userRequest("Book it")
+	req.Config = &genai.GenerateContentConfig{Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "book_flight",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"passenger": {
+						Type:       genai.TypeObject,
+						Properties: map[string]*genai.Schema{"name": {Type: genai.TypeString}},
+						Required:   []string{"name"},
+					},
+					"legs": {
+						Type:  genai.TypeArray,
+						Items: &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{"from": {Type: genai.TypeString}}},
+					},
+				},
+				Required: []string{"passenger", "legs"},
+			},
+		},
+		{Name: "get_time"},
+	}}}}
+
+	openaiReq, err := m.convertRequest(req, m.modelName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(openaiReq.Tools)
+	if err != nil {
+		t.Fatalf("failed to marshal tools: %v", err)
+	}
+	want := `[{"type":"function","function":{"name":"book_flight","strict":true,"parameters":{"additionalProperties":false,` +
+		`"properties":{"legs":{"items":{"additionalProperties":false,"properties":{"from":{"anyOf":[{"type":"string"},{"type":"null"}]}},"required":["from"],"type":"object"},"type":"array"},` +
+		`"passenger":{"additionalProperties":false,"properties":{"name":{"type":"string"}},"required":["name"],"type":"object"}},` +
+		`"required":["legs","passenger"],"type":"object"}}},` +
+		`{"type":"function","function":{"name":"get_time","strict":true,"parameters":{"additionalProperties":false,"properties":{},"type":"object"}}}]`
+	if string(data) != want {
+		t.Errorf("unexpected strict tools\n got: %s\nwant: %s", data, want)
+	}
+}
+
+func TestConvertRequest_StrictToolsOptionalFields(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{StrictTools: true}}
+	req := userRequest("Search")
+	req.Config = &genai.GenerateContentConfig{Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+		Name: "search",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"a": {Type: genai.TypeString},
+				"b": {Type: genai.TypeInteger, Description: "Optional limit"},
+				"c": {AnyOf: []*genai.Schema{{Type: genai.TypeString}, {Type: genai.TypeNumber}}},
+			},
+			Required: []string{"a"},
+		},
+	}}}}}
+
+	openaiReq, err := m.convertRequest(req, m.modelName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(openaiReq.Tools[0].Function.Parameters)
+	if err != nil {
+		t.Fatalf("failed to marshal parameters: %v", err)
+	}
+	want := `{"additionalProperties":false,"properties":{` +
+		`"a":{"type":"string"},` +
+		`"b":{"anyOf":[{"description":"Optional limit","type":"integer"},{"type":"null"}]},` +
+		`"c":{"anyOf":[{"type":"string"},{"type":"number"},{"type":"null"}]}},` +
+		`"required":["a","b","c"],"type":"object"}`
+	if string(data) != want {
+		t.Errorf("unexpected strict parameters\n got: %s\nwant: %s", data, want)
+	}
+}
+
+func TestConvertRequest_CloseObjectSchemasKeepsRequired(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{CloseObjectSchemas: true}}
+	req := userRequest("Search")
+	req.Config = &genai.GenerateContentConfig{Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+		Name: "search",
+		Parameters: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"a": {Type: genai.TypeString}, "b": {Type: genai.TypeInteger}},
+			Required:   []string{"a"},
+		},
+	}}}}}
+
+	openaiReq, err := m.convertRequest(req, m.modelName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := openaiReq.Tools[0].Function.Parameters.(map[string]any)
+	if required := params["required"].([]string); len(required) != 1 || required[0] != "a" {
+		t.Errorf("expected required to be left alone without StrictTools, got %v", required)
+	}
+}
+
+func TestCloseObjectSchemas_Nested(t *testing.T) {
+	schema := mustConvertSchema(t, &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"address": {
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"geo": {Type: genai.TypeObject, Properties: map[string]*genai.Schema{"lat": {Type: genai.TypeNumber}}},
+				},
+			},
+			"tags":  {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeObject}},
+			"value": {AnyOf: []*genai.Schema{{Type: genai.TypeString}, {Type: genai.TypeObject}}},
+		},
+	})
+
+	closeObjectSchemas(schema)
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("failed to marshal schema: %v", err)
+	}
+	want := `{"additionalProperties":false,"properties":{` +
+		`"address":{"additionalProperties":false,"properties":{"geo":{"additionalProperties":false,"properties":{"lat":{"type":"number"}},"type":"object"}},"type":"object"},` +
+		`"tags":{"items":{"additionalProperties":false,"type":"object"},"type":"array"},` +
+		`"value":{"anyOf":[{"type":"string"},{"additionalProperties":false,"type":"object"}]}},"type":"object"}`
+	if string(data) != want {
+		t.Errorf("unexpected schema\n got: %s\nwant: %s", data, want)
+	}
+}
+
+func TestCloseObjectSchemas_UpperCaseType(t *testing.T) {
+	schema := map[string]any{"type": string(genai.TypeObject)}
+
+	closeObjectSchemas(schema)
+
+	if schema["additionalProperties"] != false {
+		t.Errorf("expected an %q schema to be closed, got %v", genai.TypeObject, schema)
+	}
+}
+
+func TestConvertRequest_CloseObjectSchemas(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{CloseObjectSchemas: true}}
+	req := userRequest("Hi")
+	req.Config = &genai.GenerateContentConfig{Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+		Name: "lookup",
+		Parameters: &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{
+			"filter": {Type: genai.TypeObject, Properties: map[string]*genai.Schema{"q": {Type: genai.TypeString}}},
+		}},
+	}}}}}
+
+	openaiReq, err := m.convertRequest(req, m.modelName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fn := openaiReq.Tools[0].Function
+	if fn.Strict {
+		t.Error("expected the tool not to be marked strict")
+	}
+	params := fn.Parameters.(map[string]any)
+	if params["additionalProperties"] != false {
+		t.Errorf("expected additionalProperties:false at the top level, got %v", params["additionalProperties"])
+	}
+	if nested := propertySchema(params, "filter"); nested["additionalProperties"] != false {
+		t.Errorf("expected additionalProperties:false on the nested object, got %v", nested)
+	}
+}
+
+func TestConvertRequest_ToolsNotStrictByDefault(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+	req := userRequest("Hi")
+	req.Config = &genai.GenerateContentConfig{Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+		Name:       "lookup",
+		Parameters: &genai.Schema{Type: "object", Properties: map[string]*genai.Schema{"q": {Type: "string"}}},
+	}}}}}
+
+	openaiReq, err := m.convertRequest(req, m.modelName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fn := openaiReq.Tools[0].Function
+	if fn.Strict {
+		t.Error("expected strict to be unset by default")
+	}
+	if _, ok := fn.Parameters.(map[string]any)["additionalProperties"]; ok {
+		t.Error("expected no additionalProperties by default")
+	}
+}
+
+// ============================================================================
+// convertContent Tests
+// ============================================================================
+
+func TestConvertContent_TextMessage(t *testing.T) {
 	m := &OpenRouterModel{}
 
 	content := &genai.Content{
@@ -503,6 +1297,40 @@ func TestConvertContent_FunctionCall(t *testing.T) {
 }
 
 
+func TestConvertContent_ToolCallsWithoutText(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	content := &genai.Content{
+		Role: "model",
+		Parts: []*genai.Part{
+			{FunctionCall: &genai.FunctionCall{ID: "call_1", Name: "get_time", Args: map[string]any{}}},
+		},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if messages[0].Content != "" {
+		t.Errorf("expected no content, got %q", messages[0].Content)
+	}
+
+	data, err := json.Marshal(messages[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Contains(data, []byte(`"content"`)) {
+		t.Errorf("expected content to be absent from JSON, got %s", data)
+	}
+	if !bytes.Contains(data, []byte(`"tool_calls"`)) {
+		t.Errorf("expected tool_calls in JSON, got %s", data)
+	}
+}
+
 func TestConvertContent_FunctionResponse(t *testing.T) {
 	m := &OpenRouterModel{}
 
@@ -532,6 +1360,138 @@ func TestConvertContent_FunctionResponse(t *testing.T) {
 	if messages[0].ToolCallID != "call_123" {
 		t.Errorf("expected tool call ID 'call_123', got %q", messages[0].ToolCallID)
 	}
+	if messages[0].Name != "get_weather" {
+		t.Errorf("expected tool message name 'get_weather', got %q", messages[0].Name)
+	}
+}
+
+func TestConvertContent_FunctionResponsesWithText(t *testing.T) {
+	m := &OpenRouterModel{}
+	content := &genai.Content{
+		Role: "user",
+		Parts: []*genai.Part{
+			{Text: "Here is what I found."},
+			{FunctionResponse: &genai.FunctionResponse{ID: "call_1", Name: "get_weather", Response: map[string]any{"temp": 20}}},
+			{Text: "Anything else?"},
+			{FunctionResponse: &genai.FunctionResponse{ID: "call_2", Name: "get_time", Response: map[string]any{"time": "12:00"}}},
+		},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("expected 2 tool messages and 1 text message, got %d", len(messages))
+	}
+	if messages[0].Role != openai.ChatMessageRoleTool || messages[0].ToolCallID != "call_1" {
+		t.Errorf("expected the first function response first, got %+v", messages[0])
+	}
+	if messages[1].Role != openai.ChatMessageRoleTool || messages[1].ToolCallID != "call_2" {
+		t.Errorf("expected the second function response second, got %+v", messages[1])
+	}
+	if messages[2].Role != openai.ChatMessageRoleUser || messages[2].Content != "Here is what I found.Anything else?" {
+		t.Errorf("expected the text message last, got %+v", messages[2])
+	}
+}
+
+func TestConvertContent_FunctionResponseNilMap(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	content := &genai.Content{
+		Role: "tool",
+		Parts: []*genai.Part{{
+			FunctionResponse: &genai.FunctionResponse{ID: "call_1", Name: "clear_cache"},
+		}},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if messages[0].Content != "{}" {
+		t.Errorf("expected nil response to become '{}', got %q", messages[0].Content)
+	}
+	if messages[0].Name != "clear_cache" {
+		t.Errorf("expected tool message name 'clear_cache', got %q", messages[0].Name)
+	}
+}
+
+func TestConvertContent_FunctionResponseMultiKey(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	content := &genai.Content{
+		Role: "tool",
+		Parts: []*genai.Part{{
+			FunctionResponse: &genai.FunctionResponse{
+				ID:   "call_1",
+				Name: "get_weather",
+				Response: map[string]any{
+					"temperature": 20,
+					"unit":        "celsius",
+					"forecast":    []any{"sun", "rain"},
+					"wind":        map[string]any{"speed": 12, "direction": "NW"},
+				},
+			},
+		}},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(messages[0].Content), &decoded); err != nil {
+		t.Fatalf("expected tool content to be well-formed JSON, got %q: %v", messages[0].Content, err)
+	}
+	if len(decoded) != 4 {
+		t.Errorf("expected 4 keys in tool content, got %v", decoded)
+	}
+	if decoded["wind"].(map[string]any)["direction"] != "NW" {
+		t.Errorf("expected nested values to survive, got %v", decoded["wind"])
+	}
+	if messages[0].Name != "get_weather" {
+		t.Errorf("expected tool message name 'get_weather', got %q", messages[0].Name)
+	}
+}
+
+func TestConvertContent_MultipleFunctionResponses(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	content := &genai.Content{
+		Role: "tool",
+		Parts: []*genai.Part{
+			{FunctionResponse: &genai.FunctionResponse{ID: "call_a", Name: "get_weather", Response: map[string]any{"temp": 20}}},
+			{FunctionResponse: &genai.FunctionResponse{ID: "call_b", Name: "get_time", Response: map[string]any{"time": "12:00"}}},
+		},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 tool messages, got %d", len(messages))
+	}
+	want := []struct{ id, name string }{{"call_a", "get_weather"}, {"call_b", "get_time"}}
+	for i, w := range want {
+		if messages[i].Role != openai.ChatMessageRoleTool {
+			t.Errorf("message %d: expected role 'tool', got %q", i, messages[i].Role)
+		}
+		if messages[i].ToolCallID != w.id {
+			t.Errorf("message %d: expected tool call ID %q, got %q", i, w.id, messages[i].ToolCallID)
+		}
+		if messages[i].Name != w.name {
+			t.Errorf("message %d: expected name %q, got %q", i, w.name, messages[i].Name)
+		}
+	}
 }
 
 func TestConvertContent_EmptyContent(t *testing.T) {
@@ -552,6 +1512,69 @@ func TestConvertContent_EmptyContent(t *testing.T) {
 	}
 }
 
+func TestConvertContent_ThoughtPartOmitted(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	content := &genai.Content{
+		Role: "model",
+		Parts: []*genai.Part{
+			{Text: "The user wants a greeting.", Thought: true},
+			genai.NewPartFromText("Hello!"),
+		},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if messages[0].Content != "Hello!" {
+		t.Errorf("expected thought to be omitted, got %q", messages[0].Content)
+	}
+}
+
+func TestConvertContent_ThoughtOnlyTurnOmitted(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	content := &genai.Content{
+		Role:  "model",
+		Parts: []*genai.Part{{Text: "Thinking it over.", Thought: true}},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("expected no messages for a thought-only turn, got %d", len(messages))
+	}
+}
+
+func TestConvertContent_IncludeThoughtsInHistory(t *testing.T) {
+	m := &OpenRouterModel{cfg: OpenRouterConfig{IncludeThoughtsInHistory: true}}
+
+	content := &genai.Content{
+		Role: "model",
+		Parts: []*genai.Part{
+			{Text: "The user wants a greeting. ", Thought: true},
+			genai.NewPartFromText("Hello!"),
+		},
+	}
+
+	messages, err := m.convertContent(content)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Content != "The user wants a greeting. Hello!" {
+		t.Errorf("expected thought to be kept as text, got %+v", messages)
+	}
+}
+
 // ============================================================================
 // convertResponse Tests
 // ============================================================================
@@ -611,8 +1634,182 @@ func TestConvertResponse_WithToolCalls(t *testing.T) {
 	if result.Content.Parts[0].FunctionCall.Name != "get_weather" {
 		t.Errorf("expected function name 'get_weather', got %q", result.Content.Parts[0].FunctionCall.Name)
 	}
-	if result.Content.Parts[0].FunctionCall.ID != "call_abc123" {
-		t.Errorf("expected function call ID 'call_abc123', got %q", result.Content.Parts[0].FunctionCall.ID)
+	if result.Content.Parts[0].FunctionCall.ID != "call_abc123" {
+		t.Errorf("expected function call ID 'call_abc123', got %q", result.Content.Parts[0].FunctionCall.ID)
+	}
+}
+
+func TestConvertResponse_ToolCallWithoutID(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	msg := &openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{
+			{Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			{Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"London"}`}},
+		},
+	}
+
+	result := m.convertResponse(msg)
+
+	if len(result.Content.Parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(result.Content.Parts))
+	}
+	first := result.Content.Parts[0].FunctionCall.ID
+	second := result.Content.Parts[1].FunctionCall.ID
+	if !strings.HasPrefix(first, "call_") || !strings.HasPrefix(second, "call_") {
+		t.Errorf("expected synthetic call_ IDs, got %q and %q", first, second)
+	}
+	if first == second {
+		t.Errorf("expected distinct synthetic IDs, both were %q", first)
+	}
+
+	// The assigned ID must survive a round trip through the conversation
+	history := &genai.Content{
+		Role: genai.RoleUser,
+		Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			ID:       first,
+			Name:     "get_weather",
+			Response: map[string]any{"temp": 20},
+		}}},
+	}
+	calls, err := m.convertContent(result.Content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	responses, err := m.convertContent(history)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls[0].ToolCalls[0].ID != first || responses[0].ToolCallID != first {
+		t.Errorf("expected call and response to share ID %q, got %q and %q", first, calls[0].ToolCalls[0].ID, responses[0].ToolCallID)
+	}
+}
+
+func TestConvertResponse_ToolCallWithoutArguments(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+	for _, args := range []string{"", "null", "{}"} {
+		t.Run(fmt.Sprintf("%q", args), func(t *testing.T) {
+			msg := &openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{{
+					ID:       "call_1",
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "get_time", Arguments: args},
+				}},
+			}
+
+			result := m.convertResponse(msg)
+
+			call := result.Content.Parts[0].FunctionCall
+			if call.Args == nil {
+				t.Fatal("expected a non-nil args map")
+			}
+			if len(call.Args) != 0 {
+				t.Errorf("expected empty args, got %v", call.Args)
+			}
+		})
+	}
+}
+
+func TestConvertResponse_ArrayContent(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+	var msg openai.ChatCompletionMessage
+	raw := `{"role":"assistant","content":[{"type":"text","text":"The answer "},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}},{"type":"text","text":"is 4."}]}`
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		t.Fatalf("failed to decode array-form content: %v", err)
+	}
+
+	result := m.convertResponse(&msg)
+
+	if len(result.Content.Parts) != 1 {
+		t.Fatalf("expected 1 text part, got %d", len(result.Content.Parts))
+	}
+	if text := result.Content.Parts[0].Text; text != "The answer is 4." {
+		t.Errorf("expected the text segments joined, got %q", text)
+	}
+}
+
+func TestConvertResponse_LegacyFunctionCall(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+	msg := &openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		FunctionCall: &openai.FunctionCall{
+			Name:      "get_weather",
+			Arguments: `{"location":"London"}`,
+		},
+	}
+
+	result := m.convertResponse(msg)
+
+	if len(result.Content.Parts) != 1 {
+		t.Fatalf("expected 1 part, got %d", len(result.Content.Parts))
+	}
+	call := result.Content.Parts[0].FunctionCall
+	if call == nil {
+		t.Fatal("expected the legacy function_call to be surfaced as a function call")
+	}
+	if call.Name != "get_weather" {
+		t.Errorf("expected name 'get_weather', got %q", call.Name)
+	}
+	if call.Args["location"] != "London" {
+		t.Errorf("expected location 'London', got %v", call.Args["location"])
+	}
+	if call.ID == "" {
+		t.Error("expected a synthesized call ID")
+	}
+}
+
+func TestConvertResponse_UseNumberArgs(t *testing.T) {
+	msg := &openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{{
+			ID:       "call_1",
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "get_order", Arguments: `{"order_id":9007199254740993,"qty":2}`},
+		}},
+	}
+
+	t.Run("default decodes float64", func(t *testing.T) {
+		m := &OpenRouterModel{modelName: "test-model"}
+		args := m.convertResponse(msg).Content.Parts[0].FunctionCall.Args
+		if _, ok := args["qty"].(float64); !ok {
+			t.Errorf("expected qty to decode as float64, got %T", args["qty"])
+		}
+	})
+
+	t.Run("enabled preserves precision", func(t *testing.T) {
+		m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{UseNumberArgs: true}}
+		args := m.convertResponse(msg).Content.Parts[0].FunctionCall.Args
+		id, ok := args["order_id"].(json.Number)
+		if !ok {
+			t.Fatalf("expected order_id to decode as json.Number, got %T", args["order_id"])
+		}
+		if id.String() != "9007199254740993" {
+			t.Errorf("expected order_id 9007199254740993, got %s", id)
+		}
+		if n, err := id.Int64(); err != nil || n != 9007199254740993 {
+			t.Errorf("expected int64 9007199254740993, got %d (%v)", n, err)
+		}
+	})
+}
+
+func TestConvertResponse_ReasoningOnly(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	msg := &openai.ChatCompletionMessage{
+		Role:             openai.ChatMessageRoleAssistant,
+		ReasoningContent: "The answer is 4 because 2+2=4.",
+	}
+
+	result := m.convertResponse(msg)
+
+	if len(result.Content.Parts) != 1 {
+		t.Fatalf("expected the reasoning to be surfaced as 1 part, got %d", len(result.Content.Parts))
+	}
+	part := result.Content.Parts[0]
+	if !part.Thought || part.Text != "The answer is 4 because 2+2=4." {
+		t.Errorf("expected a thought part with the reasoning, got %+v", part)
 	}
 }
 
@@ -653,7 +1850,7 @@ func TestConvertRequest_Basic(t *testing.T) {
 		},
 	}
 
-	result, err := m.convertRequest(req)
+	result, err := m.convertRequest(req, m.modelName)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -687,7 +1884,7 @@ func TestConvertRequest_WithSystemInstruction(t *testing.T) {
 		},
 	}
 
-	result, err := m.convertRequest(req)
+	result, err := m.convertRequest(req, m.modelName)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -704,6 +1901,232 @@ func TestConvertRequest_WithSystemInstruction(t *testing.T) {
 	}
 }
 
+func TestConvertRequest_MultiPartSystemInstruction(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			genai.NewContentFromText("Hello", genai.RoleUser),
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: &genai.Content{
+				Parts: []*genai.Part{
+					genai.NewPartFromText("Rule one"),
+					genai.NewPartFromText("Rule two"),
+				},
+			},
+		},
+	}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Messages[0].Content != "Rule one\nRule two" {
+		t.Errorf("expected newline-separated system message, got %q", result.Messages[0].Content)
+	}
+}
+
+func TestConvertRequest_SystemInstructionWithoutText(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			genai.NewContentFromText("Hello", genai.RoleUser),
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: &genai.Content{
+				Parts: []*genai.Part{genai.NewPartFromBytes([]byte("png bytes"), "image/png")},
+			},
+		},
+	}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Messages) != 1 {
+		t.Fatalf("expected only the user message, got %d messages", len(result.Messages))
+	}
+	if result.Messages[0].Role != openai.ChatMessageRoleUser {
+		t.Errorf("expected no system message, got role %q first", result.Messages[0].Role)
+	}
+}
+
+func TestConvertRequest_MergesSystemContents(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			genai.NewContentFromText("Hello", genai.RoleUser),
+			genai.NewContentFromText("Always cite sources.", "system"),
+			genai.NewContentFromText("Hi there!", genai.RoleModel),
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("You are a helpful assistant.", "system"),
+		},
+	}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Messages) != 3 {
+		t.Fatalf("expected 3 messages (system + user + assistant), got %d", len(result.Messages))
+	}
+	if result.Messages[0].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("expected first message to be system, got %q", result.Messages[0].Role)
+	}
+	if result.Messages[0].Content != "You are a helpful assistant.\nAlways cite sources." {
+		t.Errorf("unexpected merged system content: %q", result.Messages[0].Content)
+	}
+	for i, msg := range result.Messages[1:] {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			t.Errorf("unexpected extra system message at index %d", i+1)
+		}
+	}
+}
+
+func TestConvertRequest_SystemContentWithoutInstruction(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			genai.NewContentFromText("Hello", genai.RoleUser),
+			genai.NewContentFromText("Be brief.", "system"),
+		},
+	}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(result.Messages))
+	}
+	if result.Messages[0].Role != openai.ChatMessageRoleSystem || result.Messages[0].Content != "Be brief." {
+		t.Errorf("expected system content moved to the front, got %+v", result.Messages[0])
+	}
+}
+
+func TestConvertRequest_MergesSystemContentWithMedia(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			{Role: "system", Parts: []*genai.Part{
+				genai.NewPartFromText("Follow the style guide."),
+				genai.NewPartFromBytes([]byte("png bytes"), "image/png"),
+			}},
+			genai.NewContentFromText("Hello", genai.RoleUser),
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("You are a helpful assistant.", "system"),
+		},
+	}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Messages) != 2 {
+		t.Fatalf("expected 2 messages (system + user), got %d", len(result.Messages))
+	}
+	if got := result.Messages[0].Content; got != "You are a helpful assistant.\nFollow the style guide." {
+		t.Errorf("expected the media content's text to be merged, got %q", got)
+	}
+}
+
+func TestBuildRequest(t *testing.T) {
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	temp := float32(0.2)
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			genai.NewContentFromText("What's the weather in Paris?", genai.RoleUser),
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("You are a weather bot.", "system"),
+			Temperature:       &temp,
+			Tools: []*genai.Tool{{
+				FunctionDeclarations: []*genai.FunctionDeclaration{{
+					Name:        "get_weather",
+					Description: "Get the weather for a city",
+					Parameters: &genai.Schema{
+						Type:       genai.TypeObject,
+						Properties: map[string]*genai.Schema{"city": {Type: genai.TypeString}},
+						Required:   []string{"city"},
+					},
+				}},
+			}},
+		},
+	}
+
+	result, err := m.BuildRequest(context.Background(), req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Model != "openai/gpt-4" {
+		t.Errorf("expected model openai/gpt-4, got %q", result.Model)
+	}
+	if result.Stream {
+		t.Error("expected a non-streaming request")
+	}
+	if len(result.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(result.Messages))
+	}
+	if result.Messages[0].Role != openai.ChatMessageRoleSystem || result.Messages[0].Content != "You are a weather bot." {
+		t.Errorf("unexpected system message: %+v", result.Messages[0])
+	}
+	if result.Messages[1].Role != openai.ChatMessageRoleUser || result.Messages[1].Content != "What's the weather in Paris?" {
+		t.Errorf("unexpected user message: %+v", result.Messages[1])
+	}
+	if len(result.Tools) != 1 || result.Tools[0].Function.Name != "get_weather" {
+		t.Fatalf("expected get_weather tool, got %+v", result.Tools)
+	}
+	if result.Temperature != 0.2 {
+		t.Errorf("expected temperature 0.2, got %v", result.Temperature)
+	}
+}
+
+func TestConvertRequest_DefaultMaxTokens(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultMax      int
+		maxOutputTokens int32
+		want            int
+	}{
+		{name: "default used when unset", defaultMax: 1024, want: 1024},
+		{name: "request value wins", defaultMax: 1024, maxOutputTokens: 256, want: 256},
+		{name: "no default", maxOutputTokens: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{DefaultMaxTokens: tt.defaultMax}}
+			req := userRequest("Hello")
+			req.Config = &genai.GenerateContentConfig{MaxOutputTokens: tt.maxOutputTokens}
+
+			result, err := m.convertRequest(req, m.modelName)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.MaxCompletionTokens != tt.want {
+				t.Errorf("expected MaxCompletionTokens %d, got %d", tt.want, result.MaxCompletionTokens)
+			}
+		})
+	}
+}
+
 func TestConvertRequest_WithTools(t *testing.T) {
 	m := &OpenRouterModel{modelName: "test-model"}
 
@@ -736,7 +2159,7 @@ func TestConvertRequest_WithTools(t *testing.T) {
 		},
 	}
 
-	result, err := m.convertRequest(req)
+	result, err := m.convertRequest(req, m.modelName)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -772,7 +2195,7 @@ func TestConvertRequest_WithGenerationConfig(t *testing.T) {
 		},
 	}
 
-	result, err := m.convertRequest(req)
+	result, err := m.convertRequest(req, m.modelName)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -798,7 +2221,7 @@ func TestConvertRequest_EmptyContents(t *testing.T) {
 		Contents: []*genai.Content{},
 	}
 
-	result, err := m.convertRequest(req)
+	result, err := m.convertRequest(req, m.modelName)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -828,7 +2251,7 @@ func TestConvertRequest_MultipleMessages(t *testing.T) {
 		},
 	}
 
-	result, err := m.convertRequest(req)
+	result, err := m.convertRequest(req, m.modelName)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -845,4 +2268,247 @@ func TestConvertRequest_MultipleMessages(t *testing.T) {
 	if result.Messages[2].Role != openai.ChatMessageRoleUser {
 		t.Errorf("expected third message role 'user', got %q", result.Messages[2].Role)
 	}
-}
\ No newline at end of file
+}
+
+func TestConvertRequest_WithLogitBias(t *testing.T) {
+	bias := map[string]int{"1639": -100, "50256": 5}
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{LogitBias: bias}}
+
+	result, err := m.convertRequest(userRequest("Hello!"), m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.LogitBias) != 2 || result.LogitBias["1639"] != -100 || result.LogitBias["50256"] != 5 {
+		t.Errorf("expected logit bias to round-trip, got %v", result.LogitBias)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"logit_bias":{"1639":-100,"50256":5}`)) {
+		t.Errorf("expected logit_bias in request body, got %s", data)
+	}
+}
+
+func TestConvertRequest_EmptyLogitBias(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{LogitBias: map[string]int{}}}
+
+	result, err := m.convertRequest(userRequest("Hello!"), m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Contains(data, []byte("logit_bias")) {
+		t.Errorf("expected logit_bias to be omitted, got %s", data)
+	}
+}
+
+func TestConvertRequest_EndUserID(t *testing.T) {
+	tests := []struct {
+		name      string
+		endUserID string
+	}{
+		{"configured", "tenant-42/user-7"},
+		{"not configured", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{EndUserID: tt.endUserID}}
+
+			result, err := m.convertRequest(userRequest("Hello!"), m.modelName)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.User != tt.endUserID {
+				t.Errorf("expected user %q, got %q", tt.endUserID, result.User)
+			}
+			data, _ := json.Marshal(result)
+			if hasUser := bytes.Contains(data, []byte(`"user":`)); hasUser != (tt.endUserID != "") {
+				t.Errorf("unexpected user field presence in %s", data)
+			}
+		})
+	}
+}
+
+func TestConvertRequest_ParallelToolCalls(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name     string
+		setting  *bool
+		wantJSON string
+	}{
+		{"true", &enabled, `"parallel_tool_calls":true`},
+		{"false", &disabled, `"parallel_tool_calls":false`},
+		{"unset", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{ParallelToolCalls: tt.setting}}
+
+			result, err := m.convertRequest(userRequest("Hello!"), m.modelName)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, _ := json.Marshal(result)
+			if tt.wantJSON == "" {
+				if bytes.Contains(data, []byte("parallel_tool_calls")) {
+					t.Errorf("expected parallel_tool_calls to be omitted, got %s", data)
+				}
+				return
+			}
+			if !bytes.Contains(data, []byte(tt.wantJSON)) {
+				t.Errorf("expected %s in request body, got %s", tt.wantJSON, data)
+			}
+		})
+	}
+}
+
+func TestConvertRequest_SamplingRanges(t *testing.T) {
+	tests := []struct {
+		name            string
+		temperature     float32
+		topP            float32
+		wantTemperature float32
+		wantTopP        float32
+	}{
+		{name: "in range", temperature: 0.7, topP: 0.9, wantTemperature: 0.7, wantTopP: 0.9},
+		{name: "bounds", temperature: 2, topP: 0, wantTemperature: 2, wantTopP: 0},
+		{name: "above range", temperature: 3, topP: 1.5, wantTemperature: 2, wantTopP: 1},
+		{name: "below range", temperature: -1, topP: -0.1, wantTemperature: 0, wantTopP: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &OpenRouterModel{modelName: "test-model"}
+			req := userRequest("Hello")
+			req.Config = &genai.GenerateContentConfig{Temperature: &tt.temperature, TopP: &tt.topP}
+
+			result, err := m.convertRequest(req, m.modelName)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Temperature != tt.wantTemperature {
+				t.Errorf("expected temperature %v, got %v", tt.wantTemperature, result.Temperature)
+			}
+			if result.TopP != tt.wantTopP {
+				t.Errorf("expected top_p %v, got %v", tt.wantTopP, result.TopP)
+			}
+		})
+	}
+}
+
+func TestConvertRequest_SamplingClampLogsWarning(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{Logger: logger}}
+	temperature := float32(3)
+	req := userRequest("Hello")
+	req.Config = &genai.GenerateContentConfig{Temperature: &temperature}
+
+	if _, err := m.convertRequest(req, m.modelName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "param=temperature") {
+		t.Errorf("expected a clamp warning for temperature, got %q", out)
+	}
+}
+
+func TestConvertRequest_StrictSampling(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{StrictSampling: true}}
+	topP := float32(1.5)
+	req := userRequest("Hello")
+	req.Config = &genai.GenerateContentConfig{TopP: &topP}
+
+	_, err := m.convertRequest(req, m.modelName)
+
+	if err == nil {
+		t.Fatal("expected error for out-of-range top_p")
+	}
+	if !strings.Contains(err.Error(), "top_p 1.5 is out of range [0, 1]") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestConvertRequest_RejectsNaNSampling(t *testing.T) {
+	nan := float32(math.NaN())
+	for _, strict := range []bool{false, true} {
+		m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{StrictSampling: strict}}
+		for name, config := range map[string]*genai.GenerateContentConfig{
+			"temperature": {Temperature: &nan},
+			"top_p":       {TopP: &nan},
+		} {
+			req := userRequest("Hello")
+			req.Config = config
+
+			_, err := m.convertRequest(req, m.modelName)
+
+			if err == nil || !strings.Contains(err.Error(), name+" is NaN") {
+				t.Errorf("strict=%v: expected a NaN %s to be rejected, got %v", strict, name, err)
+			}
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	a := map[string]any{}
+	a["zeta"] = 1
+	a["alpha"] = map[string]any{"y": "<b>", "x": []any{2.5, true}}
+	a["raw"] = json.RawMessage(`{"b":1,"a":10000000000000000001}`)
+	b := map[string]any{
+		"raw":   json.RawMessage(`{"a":10000000000000000001, "b":1}`),
+		"alpha": map[string]any{"x": []any{2.5, true}, "y": "<b>"},
+		"zeta":  1,
+	}
+
+	first, err := canonicalJSON(a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := canonicalJSON(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"alpha":{"x":[2.5,true],"y":"<b>"},"raw":{"a":10000000000000000001,"b":1},"zeta":1}`
+	if string(first) != want {
+		t.Errorf("expected %s, got %s", want, first)
+	}
+	if string(first) != string(second) {
+		t.Errorf("expected identical output, got %s and %s", first, second)
+	}
+}
+
+func TestConvertContent_CanonicalFunctionArgs(t *testing.T) {
+	m := &OpenRouterModel{modelName: "test-model"}
+	content := &genai.Content{
+		Role: "model",
+		Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{
+			ID:   "call_1",
+			Name: "search",
+			Args: map[string]any{"query": "a&b", "filters": json.RawMessage(`{"to":2,"from":1}`)},
+		}}},
+	}
+
+	msgs, err := m.convertContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"filters":{"from":1,"to":2},"query":"a&b"}`
+	if got := msgs[0].ToolCalls[0].Function.Arguments; got != want {
+		t.Errorf("expected arguments %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+)
+
+// ErrModerationBlocked is matched (via errors.Is) by the error returned when
+// the configured Moderator flags a prompt.
+var ErrModerationBlocked = errors.New("prompt blocked by moderation")
+
+// Moderator checks outgoing prompts before they are sent. Check receives the
+// text of the request's user contents and reports whether it is flagged and
+// under which categories.
+type Moderator interface {
+	Check(ctx context.Context, text string) (flagged bool, categories []string, err error)
+}
+
+// ModerationError is returned when a Moderator flags a prompt. It matches
+// ErrModerationBlocked.
+type ModerationError struct {
+	// Categories are the categories the Moderator flagged.
+	Categories []string
+}
+
+func (e *ModerationError) Error() string {
+	if len(e.Categories) == 0 {
+		return ErrModerationBlocked.Error()
+	}
+	return fmt.Sprintf("%v (%s)", ErrModerationBlocked, strings.Join(e.Categories, ", "))
+}
+
+func (e *ModerationError) Is(target error) bool {
+	return target == ErrModerationBlocked
+}
+
+// moderate runs the configured Moderator over the user text of req. It
+// returns nil when no Moderator is set or the request has no user text.
+func (m *OpenRouterModel) moderate(ctx context.Context, req *model.LLMRequest) error {
+	if m.cfg.Moderator == nil {
+		return nil
+	}
+	text := userText(req)
+	if text == "" {
+		return nil
+	}
+	flagged, categories, err := m.cfg.Moderator.Check(ctx, text)
+	if err != nil {
+		return fmt.Errorf("moderation check failed: %w", err)
+	}
+	if flagged {
+		return &ModerationError{Categories: categories}
+	}
+	return nil
+}
+
+// userText joins the text parts of the user contents of req with newlines.
+func userText(req *model.LLMRequest) string {
+	var texts []string
+	for _, content := range req.Contents {
+		if convertRole(content.Role) != openai.ChatMessageRoleUser {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part.Text != "" && !part.Thought {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// keywordModerator flags text containing any of its keywords and records the
+// text it was asked to check.
+type keywordModerator struct {
+	keywords []string
+	err      error
+	checked  []string
+}
+
+func (k *keywordModerator) Check(ctx context.Context, text string) (bool, []string, error) {
+	k.checked = append(k.checked, text)
+	if k.err != nil {
+		return false, nil, k.err
+	}
+	for _, keyword := range k.keywords {
+		if strings.Contains(text, keyword) {
+			return true, []string{"violence", "harassment"}, nil
+		}
+	}
+	return false, nil, nil
+}
+
+func TestModeration_BlocksFlaggedPrompt(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("ok", openai.FinishReasonStop)}}}
+	moderator := &keywordModerator{keywords: []string{"forbidden"}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Moderator: moderator}}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("something forbidden"), false))
+
+	if !errors.Is(err, ErrModerationBlocked) {
+		t.Fatalf("expected ErrModerationBlocked, got %v", err)
+	}
+	var modErr *ModerationError
+	if !errors.As(err, &modErr) || len(modErr.Categories) != 2 || modErr.Categories[0] != "violence" {
+		t.Errorf("expected flagged categories on the error, got %v", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected the model not to be called, got %d calls", len(fake.requests))
+	}
+}
+
+func TestModeration_AllowsCleanPrompt(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("ok", openai.FinishReasonStop)}}}
+	moderator := &keywordModerator{keywords: []string{"forbidden"}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Moderator: moderator}}
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			genai.NewContentFromText("First question", genai.RoleUser),
+			genai.NewContentFromText("forbidden reply from the model", genai.RoleModel),
+			genai.NewContentFromText("Second question", genai.RoleUser),
+		},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), req, false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fake.requests) != 1 {
+		t.Errorf("expected the model to be called once, got %d", len(fake.requests))
+	}
+	if len(moderator.checked) != 1 || moderator.checked[0] != "First question\nSecond question" {
+		t.Errorf("expected only user text to be checked, got %q", moderator.checked)
+	}
+}
+
+func TestModeration_CheckError(t *testing.T) {
+	fake := &fakeChatClient{}
+	checkErr := errors.New("moderation service down")
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{Moderator: &keywordModerator{err: checkErr}}}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if !errors.Is(err, checkErr) {
+		t.Errorf("expected the moderator error, got %v", err)
+	}
+	if errors.Is(err, ErrModerationBlocked) {
+		t.Error("expected a failed check not to be reported as blocked")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected the model not to be called, got %d calls", len(fake.requests))
+	}
+}
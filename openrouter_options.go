@@ -0,0 +1,481 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// Option configures an OpenRouterModel. A *OpenRouterConfig is itself an
+// Option, so the struct form and the With* helpers can be mixed freely.
+type Option interface {
+	apply(*OpenRouterConfig)
+}
+
+// optionFunc adapts a plain function to the Option interface.
+type optionFunc func(*OpenRouterConfig)
+
+func (f optionFunc) apply(cfg *OpenRouterConfig) {
+	f(cfg)
+}
+
+// apply replaces the whole configuration with c. Place a config struct
+// before any With* options that should refine it.
+func (c *OpenRouterConfig) apply(cfg *OpenRouterConfig) {
+	if c != nil {
+		*cfg = *c
+	}
+}
+
+// WithAPIKey sets the OpenRouter API key.
+func WithAPIKey(key string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.APIKey = key
+	})
+}
+
+// WithBaseURL sets the OpenRouter API base URL.
+func WithBaseURL(url string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.BaseURL = url
+	})
+}
+
+// WithHTTPClient sets the HTTP client used for API calls.
+func WithHTTPClient(client *http.Client) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.HTTPClient = client
+	})
+}
+
+// WithTimeout bounds each HTTP request to OpenRouter.
+func WithTimeout(timeout time.Duration) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Timeout = timeout
+	})
+}
+
+// WithStrictModelName enables "provider/model" validation of the model name.
+func WithStrictModelName() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.StrictModelName = true
+	})
+}
+
+// WithOnline selects the ":online" variant of the model, which adds web
+// search results to the prompt.
+func WithOnline() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Online = true
+	})
+}
+
+// WithNitro selects the ":nitro" variant of the model, which routes to the
+// highest-throughput providers.
+func WithNitro() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Nitro = true
+	})
+}
+
+// WithLogger sets the logger that receives debug logs of API traffic.
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Logger = logger
+	})
+}
+
+// WithTracer sets the OpenTelemetry tracer used to record generation spans.
+func WithTracer(tracer trace.Tracer) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Tracer = tracer
+	})
+}
+
+// WithOnUsage sets a callback invoked with the token usage of each completed turn.
+func WithOnUsage(fn func(model string, usage genai.GenerateContentResponseUsageMetadata)) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.OnUsage = fn
+	})
+}
+
+// WithIncludeCost asks OpenRouter to report the cost of each call.
+func WithIncludeCost() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.IncludeCost = true
+	})
+}
+
+// WithLogitBias sets the logit bias applied to every request, keyed by token ID.
+func WithLogitBias(bias map[string]int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.LogitBias = bias
+	})
+}
+
+// WithEndUserID tags every request with an end-user identifier.
+func WithEndUserID(id string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.EndUserID = id
+	})
+}
+
+// WithParallelToolCalls enables or disables parallel tool calling.
+func WithParallelToolCalls(enabled bool) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.ParallelToolCalls = &enabled
+	})
+}
+
+// WithMaxContextTokens truncates conversation history to fit within n prompt tokens.
+func WithMaxContextTokens(n int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MaxContextTokens = n
+	})
+}
+
+// WithMinP sets the min_p sampling parameter.
+func WithMinP(minP float32) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MinP = &minP
+	})
+}
+
+// WithTopA sets the top_a sampling parameter.
+func WithTopA(topA float32) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.TopA = &topA
+	})
+}
+
+// WithRepetitionPenalty sets the repetition_penalty sampling parameter.
+func WithRepetitionPenalty(penalty float32) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.RepetitionPenalty = &penalty
+	})
+}
+
+// WithMaxRetries retries responses without choices up to n times.
+func WithMaxRetries(n int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MaxRetries = n
+	})
+}
+
+// WithRetryer sets the retry policy for non-streaming calls.
+func WithRetryer(r Retryer) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Retryer = r
+	})
+}
+
+// WithCacheSystemPrompt marks the system message as cacheable on models that
+// support prompt caching.
+func WithCacheSystemPrompt() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.CacheSystemPrompt = true
+	})
+}
+
+// WithTransforms sets the OpenRouter prompt transforms, e.g. "middle-out".
+func WithTransforms(transforms ...string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Transforms = transforms
+	})
+}
+
+// WithModalities sets the output modalities to request, e.g. "text", "audio".
+func WithModalities(modalities ...string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Modalities = modalities
+	})
+}
+
+// WithAudioOutput selects the voice and format of audio output.
+func WithAudioOutput(voice, format string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Audio = &AudioOutputConfig{Voice: voice, Format: format}
+	})
+}
+
+// WithDefaultMaxTokens caps completion tokens for requests that set no
+// MaxOutputTokens of their own.
+func WithDefaultMaxTokens(n int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.DefaultMaxTokens = n
+	})
+}
+
+// WithShrinkOnOverflow retries a call that exceeded the context window once,
+// with the oldest history trimmed.
+func WithShrinkOnOverflow() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.ShrinkOnOverflow = true
+	})
+}
+
+// WithIncludeThoughtsInHistory sends thought parts of earlier turns back to
+// the model as text instead of dropping them.
+func WithIncludeThoughtsInHistory() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.IncludeThoughtsInHistory = true
+	})
+}
+
+// WithDataCollection sets the provider data collection policy: "deny" routes
+// only to providers that don't store or train on prompts.
+func WithDataCollection(policy string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.DataCollection = policy
+	})
+}
+
+// WithProviderSort routes to providers in order of "price", "throughput" or
+// "latency" instead of OpenRouter's default load balancing.
+func WithProviderSort(sort string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.ProviderSort = sort
+	})
+}
+
+// WithQuantizations limits routing to backends serving one of the given
+// quantizations, e.g. "fp16", "fp8".
+func WithQuantizations(quantizations ...string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Quantizations = quantizations
+	})
+}
+
+// WithMaxPrice limits routing to providers charging at most prompt and
+// completion USD per million tokens.
+func WithMaxPrice(prompt, completion float64) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MaxPrice = &MaxPrice{Prompt: prompt, Completion: completion}
+	})
+}
+
+// WithStrictSampling rejects requests with an out-of-range temperature or
+// top_p instead of clamping them.
+func WithStrictSampling() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.StrictSampling = true
+	})
+}
+
+// WithScalarStop sends a single stop sequence as a string, for providers that
+// reject the array form.
+func WithScalarStop() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.ScalarStop = true
+	})
+}
+
+// WithPlugins enables OpenRouter plugins for each call.
+func WithPlugins(plugins ...Plugin) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Plugins = append(cfg.Plugins, plugins...)
+	})
+}
+
+// WithWebSearch enables the web search plugin, returning at most maxResults
+// results (0 for the OpenRouter default).
+func WithWebSearch(maxResults int) Option {
+	return WithPlugins(Plugin{ID: "web", MaxResults: maxResults})
+}
+
+// WithImageDetail sets the detail level of image parts: "low", "high" or "auto".
+func WithImageDetail(detail string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.ImageDetail = detail
+	})
+}
+
+// WithExtraBody sets an arbitrary top-level request field, for OpenRouter
+// parameters the wrapper does not support yet. Fields the wrapper sets itself
+// take precedence.
+func WithExtraBody(key string, value any) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		if cfg.ExtraBody == nil {
+			cfg.ExtraBody = make(map[string]any)
+		}
+		cfg.ExtraBody[key] = value
+	})
+}
+
+// WithCache serves repeated calls with temperature 0 from cache.
+func WithCache(cache Cache) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Cache = cache
+	})
+}
+
+// WithStrictTools marks function tools strict, closing their object schemas.
+func WithStrictTools() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.StrictTools = true
+	})
+}
+
+// WithCloseObjectSchemas sets additionalProperties:false on every object in
+// tool schemas, without marking the tools strict.
+func WithCloseObjectSchemas() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.CloseObjectSchemas = true
+	})
+}
+
+// WithMaxSchemaDepth limits how deeply tool parameter schemas may nest.
+func WithMaxSchemaDepth(depth int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MaxSchemaDepth = depth
+	})
+}
+
+// WithStreamChunkMinChars coalesces streamed text into partial responses of at
+// least n characters; the remainder is flushed when the stream ends.
+func WithStreamChunkMinChars(n int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.StreamChunkMinChars = n
+	})
+}
+
+// WithModerator checks user text with moderator before each call.
+func WithModerator(moderator Moderator) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.Moderator = moderator
+	})
+}
+
+// WithValidateToolCalls rejects requests whose tool responses don't match an
+// earlier tool call, before they reach the API.
+func WithValidateToolCalls() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.ValidateToolCalls = true
+	})
+}
+
+// WithUseNumberArgs decodes numeric tool call arguments as json.Number, so
+// integers beyond float64 precision reach tools intact.
+func WithUseNumberArgs() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.UseNumberArgs = true
+	})
+}
+
+// WithMaxMessages rejects requests carrying more than n messages once any
+// history truncation has been applied.
+func WithMaxMessages(n int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MaxMessages = n
+	})
+}
+
+// WithMaxRequestBytes rejects requests whose encoded body exceeds n bytes.
+func WithMaxRequestBytes(n int) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MaxRequestBytes = n
+	})
+}
+
+// WithPartialOnCancel makes a cancelled stream yield the text generated so far
+// as a final response, with ErrorCode CancelledErrorCode, before the context
+// error.
+func WithPartialOnCancel() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.PartialOnCancel = true
+	})
+}
+
+// WithIdempotencyKeys sends a generated Idempotency-Key header with each call.
+// The key stays the same across the call's retries, so a retried request is
+// not billed twice. A key set through ContextWithHeaders takes precedence.
+func WithIdempotencyKeys() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.IdempotencyKeys = true
+	})
+}
+
+// WithFinishReason maps the finish reason reason to mapped, adding to or
+// overriding the built-in mappings.
+func WithFinishReason(reason string, mapped genai.FinishReason) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		if cfg.FinishReasons == nil {
+			cfg.FinishReasons = make(map[string]genai.FinishReason)
+		}
+		cfg.FinishReasons[reason] = mapped
+	})
+}
+
+// WithMetadata tags every request with the metadata key and value, e.g.
+// WithMetadata("tenant", "acme"), for segmenting usage and cost.
+func WithMetadata(key, value string) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		if cfg.Metadata == nil {
+			cfg.Metadata = make(map[string]string)
+		}
+		cfg.Metadata[key] = value
+	})
+}
+
+// WithInsecureSkipVerify disables TLS certificate verification, for local
+// gateways with self-signed certificates.
+//
+// WARNING: this exposes the API key and all traffic to interception. Never use
+// it in production. It has no effect when a custom HTTPClient is configured;
+// set up that client's transport instead.
+func WithInsecureSkipVerify() Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.InsecureSkipVerify = true
+	})
+}
+
+// WithBeforeRequest registers a hook that can modify each converted request,
+// e.g. to add experimental fields or drop tools, before it is sent. It runs
+// after per-request overrides such as ContextWithModel, and before streaming
+// settings are applied.
+func WithBeforeRequest(hook func(*openai.ChatCompletionRequest)) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.BeforeRequest = hook
+	})
+}
+
+// WithAfterResponse registers a hook called with every response before it is
+// yielded, e.g. to redact text or collect metrics. Streaming calls invoke it
+// for each partial response as well as the final one; resp.Partial tells
+// them apart.
+func WithAfterResponse(hook func(resp *model.LLMResponse)) Option {
+	return optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.AfterResponse = hook
+	})
+}
+
+// Environment variables read by ConfigFromEnv.
+const (
+	envAPIKey  = "OPENROUTER_API_KEY"
+	envBaseURL = "OPENROUTER_BASE_URL"
+	envSiteURL = "OPENROUTER_SITE_URL"
+	envAppName = "OPENROUTER_APP_NAME"
+)
+
+// ConfigFromEnv builds an OpenRouterConfig from the OPENROUTER_API_KEY,
+// OPENROUTER_BASE_URL, OPENROUTER_SITE_URL and OPENROUTER_APP_NAME
+// environment variables. Only the API key is required.
+func ConfigFromEnv() (*OpenRouterConfig, error) {
+	cfg := &OpenRouterConfig{
+		APIKey:  os.Getenv(envAPIKey),
+		BaseURL: os.Getenv(envBaseURL),
+		SiteURL: os.Getenv(envSiteURL),
+		AppName: os.Getenv(envAppName),
+	}
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("%s environment variable is not set", envAPIKey)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Option Tests
+// ============================================================================
+
+func TestNewOpenRouterModel_WithOptions(t *testing.T) {
+	httpClient := &http.Client{}
+
+	model, err := NewOpenRouterModel("openai/gpt-4",
+		WithAPIKey("test-api-key"),
+		WithBaseURL("https://custom.api.endpoint/v1"),
+		WithHTTPClient(httpClient),
+		WithTimeout(30*time.Second),
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if model.modelName != "openai/gpt-4" {
+		t.Errorf("expected model name 'openai/gpt-4', got %q", model.modelName)
+	}
+	if model.cfg.APIKey != "test-api-key" {
+		t.Errorf("expected API key 'test-api-key', got %q", model.cfg.APIKey)
+	}
+	if model.cfg.BaseURL != "https://custom.api.endpoint/v1" {
+		t.Errorf("expected custom base URL, got %q", model.cfg.BaseURL)
+	}
+	if model.cfg.HTTPClient != httpClient {
+		t.Error("expected configured HTTP client to be kept")
+	}
+	if model.cfg.Timeout != 30*time.Second {
+		t.Errorf("expected timeout 30s, got %v", model.cfg.Timeout)
+	}
+	if httpClient.Timeout != 0 {
+		t.Error("expected caller's HTTP client not to be mutated")
+	}
+}
+
+func TestNewOpenRouterModel_DefaultBaseURL(t *testing.T) {
+	model, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"))
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if model.cfg.BaseURL != defaultBaseURL {
+		t.Errorf("expected default base URL %q, got %q", defaultBaseURL, model.cfg.BaseURL)
+	}
+}
+
+func TestNewOpenRouterModel_CustomBasePath(t *testing.T) {
+	model, err := NewOpenRouterModel("openai/gpt-4",
+		WithAPIKey("test-api-key"),
+		WithBaseURL("https://gw.internal/proxy/openrouter"),
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if model.cfg.BaseURL != "https://gw.internal/proxy/openrouter" {
+		t.Errorf("expected base URL to be used verbatim, got %q", model.cfg.BaseURL)
+	}
+}
+
+func TestNewOpenRouterModel_ConfigThenOptions(t *testing.T) {
+	model, err := NewOpenRouterModel("openai/gpt-4",
+		&OpenRouterConfig{APIKey: "config-key", BaseURL: "https://config.endpoint/v1"},
+		WithBaseURL("https://option.endpoint/v1"),
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if model.cfg.APIKey != "config-key" {
+		t.Errorf("expected API key from config, got %q", model.cfg.APIKey)
+	}
+	if model.cfg.BaseURL != "https://option.endpoint/v1" {
+		t.Errorf("expected option to override config base URL, got %q", model.cfg.BaseURL)
+	}
+}
+
+func TestNewOpenRouterModel_OptionsMissingAPIKey(t *testing.T) {
+	model, err := NewOpenRouterModel("openai/gpt-4", WithTimeout(time.Second))
+
+	if err == nil {
+		t.Fatal("expected error for missing API key")
+	}
+	if model != nil {
+		t.Error("expected model to be nil on error")
+	}
+}
+
+func TestNewOpenRouterModel_TypedNilConfig(t *testing.T) {
+	var cfg *OpenRouterConfig
+
+	_, err := NewOpenRouterModel("openai/gpt-4", cfg)
+
+	if err == nil {
+		t.Fatal("expected error for nil config")
+	}
+}
+
+func TestNewOpenRouterModel_ModelVariants(t *testing.T) {
+	tests := []struct {
+		name      string
+		modelName string
+		opts      []Option
+		want      string
+	}{
+		{"online", "openai/gpt-4", []Option{WithOnline()}, "openai/gpt-4:online"},
+		{"nitro", "openai/gpt-4", []Option{WithNitro()}, "openai/gpt-4:nitro"},
+		{"both", "openai/gpt-4", []Option{WithOnline(), WithNitro()}, "openai/gpt-4:online:nitro"},
+		{"already online", "openai/gpt-4:online", []Option{WithOnline()}, "openai/gpt-4:online"},
+		{"repeated option", "openai/gpt-4", []Option{WithOnline(), WithOnline()}, "openai/gpt-4:online"},
+		{"other variant", "meta-llama/llama-3-8b:free", []Option{WithNitro()}, "meta-llama/llama-3-8b:free:nitro"},
+		{"none", "openai/gpt-4", nil, "openai/gpt-4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithAPIKey("test-api-key")}, tt.opts...)
+			model, err := NewOpenRouterModel(tt.modelName, opts...)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if model.Name() != tt.want {
+				t.Errorf("expected model name %q, got %q", tt.want, model.Name())
+			}
+		})
+	}
+}
+
+// ============================================================================
+// ConfigFromEnv Tests
+// ============================================================================
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("OPENROUTER_API_KEY", "env-key")
+	t.Setenv("OPENROUTER_BASE_URL", "https://env.endpoint/v1")
+	t.Setenv("OPENROUTER_SITE_URL", "https://example.com")
+	t.Setenv("OPENROUTER_APP_NAME", "My Agent")
+
+	cfg, err := ConfigFromEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.APIKey != "env-key" {
+		t.Errorf("expected API key 'env-key', got %q", cfg.APIKey)
+	}
+	if cfg.BaseURL != "https://env.endpoint/v1" {
+		t.Errorf("expected base URL from env, got %q", cfg.BaseURL)
+	}
+	if cfg.SiteURL != "https://example.com" {
+		t.Errorf("expected site URL from env, got %q", cfg.SiteURL)
+	}
+	if cfg.AppName != "My Agent" {
+		t.Errorf("expected app name from env, got %q", cfg.AppName)
+	}
+}
+
+func TestConfigFromEnv_OnlyAPIKey(t *testing.T) {
+	t.Setenv("OPENROUTER_API_KEY", "env-key")
+	t.Setenv("OPENROUTER_BASE_URL", "")
+	t.Setenv("OPENROUTER_SITE_URL", "")
+	t.Setenv("OPENROUTER_APP_NAME", "")
+
+	cfg, err := ConfigFromEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.BaseURL != "" || cfg.SiteURL != "" || cfg.AppName != "" {
+		t.Errorf("expected optional fields to be empty, got %+v", cfg)
+	}
+
+	model, err := NewOpenRouterModel("openai/gpt-4", cfg)
+	if err != nil {
+		t.Fatalf("expected env config to build a model, got %v", err)
+	}
+	if model.cfg.BaseURL != defaultBaseURL {
+		t.Errorf("expected default base URL, got %q", model.cfg.BaseURL)
+	}
+}
+
+func TestConfigFromEnv_MissingAPIKey(t *testing.T) {
+	t.Setenv("OPENROUTER_API_KEY", "")
+
+	cfg, err := ConfigFromEnv()
+
+	if err == nil {
+		t.Fatal("expected error for missing API key")
+	}
+	if cfg != nil {
+		t.Error("expected config to be nil on error")
+	}
+	if err.Error() != "OPENROUTER_API_KEY environment variable is not set" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitInfo is a snapshot of the rate-limit headers OpenRouter returned
+// with a response.
+type RateLimitInfo struct {
+	// Limit is the number of requests allowed in the current window.
+	Limit int
+	// Remaining is the number of requests left in the current window.
+	Remaining int
+	// Reset is when the current window ends.
+	Reset time.Time
+}
+
+// rateLimitTracker holds the most recent rate-limit snapshot. It is shared by
+// concurrent calls on the same model.
+type rateLimitTracker struct {
+	mu   sync.Mutex
+	last RateLimitInfo
+}
+
+func (t *rateLimitTracker) store(info RateLimitInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = info
+}
+
+func (t *rateLimitTracker) load() RateLimitInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+// LastRateLimit returns the rate-limit headers of the most recent response
+// that carried them, or the zero value if none has.
+func (m *OpenRouterModel) LastRateLimit() RateLimitInfo {
+	if m.rateLimit == nil {
+		return RateLimitInfo{}
+	}
+	return m.rateLimit.load()
+}
+
+// parseRateLimit reads the X-RateLimit-* headers. It reports false when the
+// response carries none of them.
+func parseRateLimit(header http.Header) (RateLimitInfo, bool) {
+	limit, hasLimit := headerInt(header, "X-RateLimit-Limit")
+	remaining, hasRemaining := headerInt(header, "X-RateLimit-Remaining")
+	reset, hasReset := headerInt(header, "X-RateLimit-Reset")
+	if !hasLimit && !hasRemaining && !hasReset {
+		return RateLimitInfo{}, false
+	}
+
+	info := RateLimitInfo{Limit: int(limit), Remaining: int(remaining)}
+	if hasReset {
+		// OpenRouter sends a Unix timestamp in milliseconds
+		if reset > 1e12 {
+			info.Reset = time.UnixMilli(reset)
+		} else {
+			info.Reset = time.Unix(reset, 0)
+		}
+	}
+	return info, true
+}
+
+// headerInt parses an integer header value.
+func headerInt(header http.Header, key string) (int64, bool) {
+	value := header.Get(key)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Rate Limit Tests
+// ============================================================================
+
+func TestLastRateLimit_CapturedFromResponse(t *testing.T) {
+	remaining := []string{"19", "18"}
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Limit", "20")
+		w.Header().Set("X-RateLimit-Remaining", remaining[calls])
+		w.Header().Set("X-RateLimit-Reset", "1760000000000")
+		calls++
+		_, _ = w.Write([]byte(stubCompletion))
+	}))
+	t.Cleanup(server.Close)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := m.LastRateLimit(); got != (RateLimitInfo{}) {
+		t.Errorf("expected zero value before any call, got %+v", got)
+	}
+
+	for range remaining {
+		if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got := m.LastRateLimit()
+	if got.Limit != 20 || got.Remaining != 18 {
+		t.Errorf("expected limit 20 and remaining 18 from the latest response, got %+v", got)
+	}
+	if !got.Reset.Equal(time.UnixMilli(1760000000000)) {
+		t.Errorf("unexpected reset time: %v", got.Reset)
+	}
+}
+
+func TestLastRateLimit_CapturedFromErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Limit", "20")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"code":429,"message":"Rate limit exceeded"}}`))
+	}))
+	t.Cleanup(server.Close)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+
+	if got := m.LastRateLimit(); got.Limit != 20 || got.Remaining != 0 {
+		t.Errorf("expected headers from the 429 response, got %+v", got)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   RateLimitInfo
+		ok     bool
+	}{
+		{
+			name:   "no headers",
+			header: http.Header{},
+		},
+		{
+			name:   "seconds reset",
+			header: http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Reset": {"1760000000"}},
+			want:   RateLimitInfo{Remaining: 5, Reset: time.Unix(1760000000, 0)},
+			ok:     true,
+		},
+		{
+			name:   "malformed values ignored",
+			header: http.Header{"X-Ratelimit-Limit": {"many"}, "X-Ratelimit-Remaining": {"3"}},
+			want:   RateLimitInfo{Remaining: 3},
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRateLimit(tt.header)
+			if ok != tt.ok || got.Limit != tt.want.Limit || got.Remaining != tt.want.Remaining || !got.Reset.Equal(tt.want.Reset) {
+				t.Errorf("parseRateLimit() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
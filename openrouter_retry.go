@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrNoChoices is returned, and passed to Retryer, when OpenRouter answers a
+// non-streaming call with an empty choices list.
+var ErrNoChoices = errors.New("openrouter returned no choices")
+
+// Default backoff bounds used when MaxRetries is set without a Retryer.
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 2 * time.Second
+)
+
+// Retryer decides whether a failed non-streaming call is retried. NextDelay
+// is called with the number of attempts made so far (starting at 1) and the
+// error of the last one, which is either an API error or ErrNoChoices. It
+// returns how long to wait before the next attempt, or false to give up. A
+// wait that would outlast the context's deadline ends the retries early.
+type Retryer interface {
+	NextDelay(attempt int, err error) (time.Duration, bool)
+}
+
+// ExponentialBackoff is a Retryer using exponential backoff with full
+// jitter: before retry n it waits a random duration in
+// [0, min(MaxDelay, BaseDelay*2^(n-1))).
+type ExponentialBackoff struct {
+	// BaseDelay bounds the wait before the first retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the bound as it grows (optional, uncapped when zero).
+	MaxDelay time.Duration
+	// MaxRetries is how many times a call is retried.
+	MaxRetries int
+	// Retryable reports whether err is worth retrying (optional, only
+	// ErrNoChoices by default).
+	Retryable func(err error) bool
+}
+
+// NextDelay implements Retryer.
+func (b ExponentialBackoff) NextDelay(attempt int, err error) (time.Duration, bool) {
+	if attempt > b.MaxRetries {
+		return 0, false
+	}
+	retryable := b.Retryable
+	if retryable == nil {
+		retryable = func(err error) bool { return errors.Is(err, ErrNoChoices) }
+	}
+	if !retryable(err) {
+		return 0, false
+	}
+	return jitter(b.bound(attempt)), true
+}
+
+// bound returns the upper limit of the wait before retry number attempt.
+func (b ExponentialBackoff) bound(attempt int) time.Duration {
+	bound := b.BaseDelay
+	for range attempt - 1 {
+		if bound > math.MaxInt64/2 || (b.MaxDelay > 0 && bound >= b.MaxDelay) {
+			break
+		}
+		bound *= 2
+	}
+	if b.MaxDelay > 0 && bound > b.MaxDelay {
+		bound = b.MaxDelay
+	}
+	return bound
+}
+
+// jitter returns a random duration in [0, bound).
+func jitter(bound time.Duration) time.Duration {
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(bound)))
+}
+
+// retryer returns the configured Retryer, or the default backoff allowing
+// MaxRetries retries of responses without choices.
+func (m *OpenRouterModel) retryer() Retryer {
+	if m.cfg.Retryer != nil {
+		return m.cfg.Retryer
+	}
+	return ExponentialBackoff{
+		BaseDelay:  defaultRetryBaseDelay,
+		MaxDelay:   defaultRetryMaxDelay,
+		MaxRetries: m.cfg.MaxRetries,
+	}
+}
+
+// fitsDeadline reports whether waiting d still leaves time before ctx's
+// deadline, if it has one.
+func fitsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > d
+}
+
+// sleep waits for d or until ctx is done, returning the context's error in
+// the latter case.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
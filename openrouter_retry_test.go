@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ============================================================================
+// ExponentialBackoff Tests
+// ============================================================================
+
+func TestExponentialBackoff_DelayGrowth(t *testing.T) {
+	b := ExponentialBackoff{BaseDelay: 10 * time.Millisecond, MaxDelay: 80 * time.Millisecond, MaxRetries: 10}
+
+	tests := []struct {
+		attempt int
+		bound   time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 80 * time.Millisecond},
+		{8, 80 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := b.bound(tt.attempt); got != tt.bound {
+			t.Errorf("bound(%d) = %v, want %v", tt.attempt, got, tt.bound)
+		}
+		var longest time.Duration
+		for range 200 {
+			delay, ok := b.NextDelay(tt.attempt, ErrNoChoices)
+			if !ok {
+				t.Fatalf("expected attempt %d to be retried", tt.attempt)
+			}
+			if delay < 0 || delay >= tt.bound {
+				t.Fatalf("attempt %d: delay %v outside [0, %v)", tt.attempt, delay, tt.bound)
+			}
+			longest = max(longest, delay)
+		}
+		if longest < tt.bound/2 {
+			t.Errorf("attempt %d: expected jittered delays to spread toward %v, longest was %v", tt.attempt, tt.bound, longest)
+		}
+	}
+}
+
+func TestExponentialBackoff_Limits(t *testing.T) {
+	b := ExponentialBackoff{BaseDelay: time.Millisecond, MaxRetries: 2}
+
+	if _, ok := b.NextDelay(2, ErrNoChoices); !ok {
+		t.Error("expected the second attempt to be retried")
+	}
+	if _, ok := b.NextDelay(3, ErrNoChoices); ok {
+		t.Error("expected no retry after MaxRetries")
+	}
+	if _, ok := b.NextDelay(1, errors.New("bad request")); ok {
+		t.Error("expected other errors not to be retried by default")
+	}
+	if got := b.bound(200); got <= 0 {
+		t.Errorf("expected an uncapped bound not to overflow, got %v", got)
+	}
+
+	b.Retryable = func(error) bool { return true }
+	if _, ok := b.NextDelay(1, errors.New("bad request")); !ok {
+		t.Error("expected Retryable to widen the retried errors")
+	}
+}
+
+// ============================================================================
+// Custom Retryer Tests
+// ============================================================================
+
+// retryerFunc adapts a function to the Retryer interface.
+type retryerFunc func(attempt int, err error) (time.Duration, bool)
+
+func (f retryerFunc) NextDelay(attempt int, err error) (time.Duration, bool) {
+	return f(attempt, err)
+}
+
+func TestRetryer_StopsAfterOneAttempt(t *testing.T) {
+	apiErr := &openai.APIError{HTTPStatusCode: 503, Message: "overloaded"}
+	fake := &fakeChatClient{completions: []fakeCompletion{{err: apiErr}}}
+	var calls []int
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		MaxRetries: 5,
+		Retryer: retryerFunc(func(attempt int, err error) (time.Duration, bool) {
+			calls = append(calls, attempt)
+			return 0, false
+		}),
+	}}
+
+	_, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if !errors.Is(err, apiErr) {
+		t.Errorf("expected wrapped API error, got %v", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(fake.requests))
+	}
+	if len(calls) != 1 || calls[0] != 1 {
+		t.Errorf("expected the retryer to be consulted once for attempt 1, got %v", calls)
+	}
+}
+
+func TestRetryer_RetriesAPIErrors(t *testing.T) {
+	apiErr := &openai.APIError{HTTPStatusCode: 503, Message: "overloaded"}
+	fake := &fakeChatClient{completions: []fakeCompletion{
+		{err: apiErr},
+		{resp: textCompletion("Recovered", openai.FinishReasonStop)},
+	}}
+	var seen error
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		Retryer: retryerFunc(func(attempt int, err error) (time.Duration, bool) {
+			seen = err
+			return time.Millisecond, attempt < 3
+		}),
+	}}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(seen, apiErr) {
+		t.Errorf("expected the retryer to see the API error, got %v", seen)
+	}
+	if responses[0].Content.Parts[0].Text != "Recovered" {
+		t.Errorf("expected the retried response, got %+v", responses[0])
+	}
+}
+
+func TestRetryer_CancelDuringDelay(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: openai.ChatCompletionResponse{}}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		Retryer: retryerFunc(func(int, error) (time.Duration, bool) {
+			cancel()
+			return time.Hour, true
+		}),
+	}}
+
+	_, err := collect(m.GenerateContent(ctx, userRequest("Hi"), false))
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("expected no attempt after cancellation, got %d", len(fake.requests))
+	}
+}
+
+func TestRetryer_StopsBeforeDeadline(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: openai.ChatCompletionResponse{}}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		Retryer: retryerFunc(func(int, error) (time.Duration, bool) {
+			return 200 * time.Millisecond, true
+		}),
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := collect(m.GenerateContent(ctx, userRequest("Hi"), false))
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrNoChoices) {
+		t.Errorf("expected the last error rather than the context's, got %v", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("expected no retry past the deadline, got %d attempts", len(fake.requests))
+	}
+	if elapsed >= 100*time.Millisecond {
+		t.Errorf("expected to return before the deadline, took %v", elapsed)
+	}
+}
+
+func TestRetryer_RetriesWithinDeadline(t *testing.T) {
+	fake := &fakeChatClient{completions: []fakeCompletion{
+		{resp: openai.ChatCompletionResponse{}},
+		{resp: textCompletion("Recovered", openai.FinishReasonStop)},
+	}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{
+		Retryer: retryerFunc(func(attempt int, err error) (time.Duration, bool) {
+			return time.Millisecond, attempt < 3
+		}),
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := collect(m.GenerateContent(ctx, userRequest("Hi"), false)); err != nil {
+		t.Fatalf("expected a retry that fits the deadline to succeed, got %v", err)
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(fake.requests))
+	}
+}
+
+func TestFitsDeadline(t *testing.T) {
+	if !fitsDeadline(context.Background(), time.Hour) {
+		t.Error("expected any delay to fit without a deadline")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !fitsDeadline(ctx, 10*time.Millisecond) {
+		t.Error("expected a short delay to fit")
+	}
+	if fitsDeadline(ctx, time.Minute) {
+		t.Error("expected a delay past the deadline not to fit")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+)
+
+// Token accounting overheads for chat messages, following OpenAI's published
+// counting rules for GPT-3.5/GPT-4 chat models.
+const (
+	tokensPerMessage = 3 // <|start|>{role}\n{content}<|end|>\n
+	tokensPerName    = 1
+	tokensPerReply   = 3 // every reply is primed with <|start|>assistant<|message|>
+	// tokensPerAudioPart is a flat estimate for an input_audio part. Its Text
+	// holds the base64 audio, which would otherwise be counted as words.
+	tokensPerAudioPart = 200
+)
+
+// pretokenizer splits text the way GPT-family BPE tokenizers do before
+// merging: contractions, letter runs, up to three digits, punctuation runs
+// and whitespace.
+var pretokenizer = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// CountTokens estimates the number of prompt tokens req will consume once
+// converted and sent with ctx, honouring a ContextWithModel override. The estimate approximates GPT-family (cl100k/o200k) tokenization
+// and is usually within ~10% for English text. It is scaled up for model
+// families whose tokenizers are known to produce more tokens (see tokenRatio);
+// either way, treat it as a guide rather than an exact count.
+func (m *OpenRouterModel) CountTokens(ctx context.Context, req *model.LLMRequest) (int, error) {
+	openaiReq, err := m.convertRequest(req, m.requestModel(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert request: %w", err)
+	}
+
+	toolTokens, err := countToolTokens(openaiReq.Tools)
+	if err != nil {
+		return 0, err
+	}
+	n := tokensPerReply + toolTokens + countMessagesTokens(openaiReq.Messages)
+	return int(math.Ceil(float64(n) * tokenRatio(openaiReq.Model))), nil
+}
+
+// tokenRatio returns how many of modelName's tokens one GPT-family token is
+// worth. Claude's tokenizer produces about 20% more tokens for the same
+// English text; Gemini, Llama and most other families land close enough to
+// the GPT estimate that no scaling is applied.
+func tokenRatio(modelName string) float64 {
+	switch {
+	case strings.HasPrefix(modelName, "anthropic/"):
+		return 1.2
+	default:
+		return 1
+	}
+}
+
+// gptTokenBudget converts a budget in modelName's tokens to the GPT-family
+// units the estimators count in.
+func gptTokenBudget(budget int, modelName string) int {
+	return int(float64(budget) / tokenRatio(modelName))
+}
+
+// countToolTokens estimates the tokens used by tool definitions.
+func countToolTokens(tools []openai.Tool) (int, error) {
+	if len(tools) == 0 {
+		return 0, nil
+	}
+	toolsJSON, err := json.Marshal(tools)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal tools: %w", err)
+	}
+	return estimateTokens(string(toolsJSON)), nil
+}
+
+// countMessagesTokens estimates the tokens used by a list of chat messages.
+func countMessagesTokens(messages []openai.ChatCompletionMessage) int {
+	total := 0
+	for _, msg := range messages {
+		total += countMessageTokens(msg)
+	}
+	return total
+}
+
+// countMessageTokens estimates the tokens used by a single chat message.
+func countMessageTokens(msg openai.ChatCompletionMessage) int {
+	n := tokensPerMessage + estimateTokens(msg.Role) + estimateTokens(msg.Content)
+	for _, part := range msg.MultiContent {
+		if part.Type == chatMessagePartTypeInputAudio {
+			n += tokensPerAudioPart
+			continue
+		}
+		n += estimateTokens(part.Text)
+	}
+	if msg.Name != "" {
+		n += tokensPerName + estimateTokens(msg.Name)
+	}
+	for _, tc := range msg.ToolCalls {
+		n += estimateTokens(tc.Function.Name) + estimateTokens(tc.Function.Arguments)
+	}
+	return n
+}
+
+// estimateTokens approximates the BPE token count of text. Each pre-token
+// costs one token, except long words, which BPE splits into several pieces,
+// and non-Latin scripts, which average about one token per character.
+func estimateTokens(text string) int {
+	n := 0
+	for _, piece := range pretokenizer.FindAllString(text, -1) {
+		n += estimatePieceTokens(piece)
+	}
+	return n
+}
+
+// estimatePieceTokens approximates the tokens in a single pre-token.
+func estimatePieceTokens(piece string) int {
+	runes := utf8.RuneCountInString(piece)
+	for _, r := range piece {
+		if r > unicode.MaxASCII && unicode.IsLetter(r) {
+			return runes
+		}
+	}
+	// Common words up to ~10 characters (including a leading space) are a
+	// single token; longer ones split roughly every 5 characters.
+	if runes <= 10 {
+		return 1
+	}
+	return 1 + (runes-10+4)/5
+}
+
+// truncateMessages drops the oldest messages until the estimated total fits
+// within budget tokens. System messages and everything from the most recent
+// user message onwards are always kept, and tool results whose originating
+// call was dropped go with it. If the protected messages alone exceed the
+// budget, they are returned as is.
+func truncateMessages(messages []openai.ChatCompletionMessage, budget int) []openai.ChatCompletionMessage {
+	if countMessagesTokens(messages) <= budget {
+		return messages
+	}
+
+	// Messages from the latest user turn onwards are never dropped
+	protectedFrom := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			protectedFrom = i
+			break
+		}
+	}
+
+	dropped := make([]bool, len(messages))
+	total := countMessagesTokens(messages)
+	for i := 0; i < protectedFrom && total > budget; i++ {
+		if messages[i].Role == openai.ChatMessageRoleSystem {
+			continue
+		}
+		dropped[i] = true
+		total -= countMessageTokens(messages[i])
+
+		// Tool results can't outlive the assistant message that requested them
+		for i+1 < protectedFrom && messages[i+1].Role == openai.ChatMessageRoleTool {
+			i++
+			dropped[i] = true
+			total -= countMessageTokens(messages[i])
+		}
+	}
+
+	kept := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for i, msg := range messages {
+		if !dropped[i] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// shrinkForOverflow trims the oldest history from req after it was rejected
+// with a context-length error. The budget comes from the limit stated in err
+// when there is one, converted to GPT-family units for req.Model, and is
+// otherwise three quarters of the current estimate.
+// It reports whether any message was dropped.
+func shrinkForOverflow(req *openai.ChatCompletionRequest, err error) bool {
+	current := countMessagesTokens(req.Messages)
+	budget := current * 3 / 4
+	if limit, ok := contextLimit(err); ok {
+		toolTokens, toolErr := countToolTokens(req.Tools)
+		if toolErr != nil {
+			return false
+		}
+		budget = min(budget, gptTokenBudget(limit-req.MaxCompletionTokens, req.Model)-toolTokens-tokensPerReply)
+	}
+
+	trimmed := truncateMessages(req.Messages, budget)
+	if len(trimmed) == len(req.Messages) {
+		return false
+	}
+	req.Messages = trimmed
+	return true
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// ============================================================================
+// estimateTokens Tests
+// ============================================================================
+
+func TestEstimateTokens(t *testing.T) {
+	// Expected values are the cl100k_base token counts of each input.
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"", 0},
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"I'm sure it's fine.", 7},
+		{"12345", 2},
+		{"user", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := estimateTokens(tt.text); got != tt.expected {
+				t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEstimateTokens_WithinMargin(t *testing.T) {
+	// cl100k_base encodes this paragraph as roughly 34 tokens.
+	text := "OpenRouter provides a unified API that gives you access to hundreds of AI models " +
+		"through a single endpoint, while automatically handling fallbacks and selecting " +
+		"the most cost-effective options."
+	const actual = 34
+
+	got := estimateTokens(text)
+
+	if diff := got - actual; diff < -actual/5 || diff > actual/5 {
+		t.Errorf("estimateTokens() = %d, want within 20%% of %d", got, actual)
+	}
+}
+
+// ============================================================================
+// CountTokens Tests
+// ============================================================================
+
+func TestCountTokens_SingleMessage(t *testing.T) {
+	m := &OpenRouterModel{modelName: "openai/gpt-4"}
+
+	got, err := m.CountTokens(context.Background(), userRequest("Hello, world!"))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 3 (message) + 1 (role) + 4 (content) + 3 (reply priming)
+	if got != 11 {
+		t.Errorf("CountTokens() = %d, want 11", got)
+	}
+}
+
+func TestCountTokens_ScalesForClaude(t *testing.T) {
+	req := userRequest("Summarize the quarterly report in three short bullet points.")
+	gpt, _ := (&OpenRouterModel{modelName: "openai/gpt-4"}).CountTokens(context.Background(), req)
+	gemini, _ := (&OpenRouterModel{modelName: "google/gemini-2.0-flash"}).CountTokens(context.Background(), req)
+
+	claude, err := (&OpenRouterModel{modelName: "anthropic/claude-3.5-sonnet"}).CountTokens(context.Background(), req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := int(math.Ceil(float64(gpt) * 1.2)); claude != want {
+		t.Errorf("expected the Claude estimate to be scaled to %d, got %d (GPT estimate %d)", want, claude, gpt)
+	}
+	if gemini != gpt {
+		t.Errorf("expected the Gemini estimate to match the GPT one (%d), got %d", gpt, gemini)
+	}
+}
+
+func TestCountTokens_UsesModelOverride(t *testing.T) {
+	req := userRequest("Summarize the quarterly report in three short bullet points.")
+	m := &OpenRouterModel{modelName: "openai/gpt-4"}
+	claude, _ := (&OpenRouterModel{modelName: "anthropic/claude-3.5-sonnet"}).CountTokens(context.Background(), req)
+
+	got, err := m.CountTokens(ContextWithModel(context.Background(), "anthropic/claude-3.5-sonnet"), req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != claude {
+		t.Errorf("expected the overridden call to be estimated for Claude (%d), got %d", claude, got)
+	}
+}
+
+func TestCountTokens_AudioPart(t *testing.T) {
+	m := &OpenRouterModel{modelName: "openai/gpt-4o-audio-preview"}
+	req := &model.LLMRequest{Contents: []*genai.Content{{
+		Role: genai.RoleUser,
+		Parts: []*genai.Part{
+			genai.NewPartFromText("Transcribe"),
+			genai.NewPartFromBytes(make([]byte, 200*1024), "audio/wav"),
+		},
+	}}}
+
+	got, err := m.CountTokens(context.Background(), req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 3 (message) + 1 (role) + 1 (text) + flat audio estimate + 3 (reply priming)
+	if want := 8 + tokensPerAudioPart; got != want {
+		t.Errorf("CountTokens() = %d, want %d; the base64 audio must not be counted as text", got, want)
+	}
+}
+
+func TestCountTokens_WithSystemInstruction(t *testing.T) {
+	m := &OpenRouterModel{modelName: "openai/gpt-4"}
+	req := userRequest("Hello, world!")
+	req.Config = &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText("You are a helpful assistant.", "system"),
+	}
+
+	got, err := m.CountTokens(context.Background(), req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 11 as above, plus 3 (message) + 1 (role) + 6 (content)
+	if got != 21 {
+		t.Errorf("CountTokens() = %d, want 21", got)
+	}
+}
+
+func TestCountTokens_Empty(t *testing.T) {
+	m := &OpenRouterModel{modelName: "openai/gpt-4"}
+
+	got, err := m.CountTokens(context.Background(), &model.LLMRequest{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != tokensPerReply {
+		t.Errorf("CountTokens() = %d, want %d", got, tokensPerReply)
+	}
+}
+
+func TestCountTokens_IncludesTools(t *testing.T) {
+	m := &OpenRouterModel{modelName: "openai/gpt-4"}
+	withoutTools, _ := m.CountTokens(context.Background(), userRequest("Weather?"))
+
+	req := userRequest("Weather?")
+	req.Config = &genai.GenerateContentConfig{
+		Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+			Name:        "get_weather",
+			Description: "Get weather for a city",
+		}}}},
+	}
+	withTools, err := m.CountTokens(context.Background(), req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if withTools <= withoutTools {
+		t.Errorf("expected tools to add tokens, got %d with and %d without", withTools, withoutTools)
+	}
+}
+
+// ============================================================================
+// Truncation Tests
+// ============================================================================
+
+// historyRequest builds a request with a system instruction and alternating
+// user/model turns, ending with a user turn.
+func historyRequest(turns ...string) *model.LLMRequest {
+	req := &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("You are a helpful assistant.", "system"),
+		},
+	}
+	for i, text := range turns {
+		role := genai.Role(genai.RoleUser)
+		if i%2 == 1 {
+			role = genai.RoleModel
+		}
+		req.Contents = append(req.Contents, genai.NewContentFromText(text, role))
+	}
+	return req
+}
+
+func TestConvertRequest_MaxContextTokensDropsOldest(t *testing.T) {
+	req := historyRequest(
+		"First question about something long ago",
+		"First answer with plenty of detail",
+		"Second question",
+		"Second answer",
+		"Latest question",
+	)
+	// Leave room for everything except the first exchange
+	limit, _ := (&OpenRouterModel{}).CountTokens(context.Background(), historyRequest(
+		"Second question",
+		"Second answer",
+		"Latest question",
+	))
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxContextTokens: limit}}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var contents []string
+	for _, msg := range result.Messages {
+		contents = append(contents, msg.Content)
+	}
+	want := []string{"You are a helpful assistant.", "Second question", "Second answer", "Latest question"}
+	if len(contents) != len(want) {
+		t.Fatalf("expected messages %q, got %q", want, contents)
+	}
+	for i := range want {
+		if contents[i] != want[i] {
+			t.Errorf("message %d: expected %q, got %q", i, want[i], contents[i])
+		}
+	}
+	if got, _ := m.CountTokens(context.Background(), req); got > limit {
+		t.Errorf("expected truncated prompt to fit %d tokens, got %d", limit, got)
+	}
+}
+
+func TestConvertRequest_MaxContextTokensScalesForClaude(t *testing.T) {
+	req := historyRequest(
+		"First question about something long ago",
+		"First answer with plenty of detail",
+		"Second question",
+		"Second answer",
+		"Latest question",
+	)
+	// Exactly the GPT estimate of the full history, which Claude exceeds
+	limit, _ := (&OpenRouterModel{modelName: "openai/gpt-4"}).CountTokens(context.Background(), req)
+	m := &OpenRouterModel{modelName: "anthropic/claude-3.5-sonnet", cfg: OpenRouterConfig{MaxContextTokens: limit}}
+	if full, _ := (&OpenRouterModel{modelName: m.modelName}).CountTokens(context.Background(), req); full <= limit {
+		t.Fatalf("expected the full Claude estimate to exceed %d tokens, got %d", limit, full)
+	}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Messages) >= 6 {
+		t.Errorf("expected the oldest history to be dropped for Claude, got %d messages", len(result.Messages))
+	}
+	got := int(math.Ceil(float64(tokensPerReply+countMessagesTokens(result.Messages)) * tokenRatio(m.modelName)))
+	if got > limit {
+		t.Errorf("expected truncated prompt to fit %d Claude tokens, got %d", limit, got)
+	}
+}
+
+func TestGenerateContent_MaxContextTokensUsesModelOverride(t *testing.T) {
+	req := historyRequest(
+		"First question about something long ago",
+		"First answer with plenty of detail",
+		"Second question",
+		"Second answer",
+		"Latest question",
+	)
+	// Exactly the GPT estimate of the full history, which Claude exceeds
+	limit, _ := (&OpenRouterModel{modelName: "openai/gpt-4"}).CountTokens(context.Background(), req)
+	fake := &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("ok", openai.FinishReasonStop)}}}
+	m := &OpenRouterModel{chat: fake, modelName: "openai/gpt-4", cfg: OpenRouterConfig{MaxContextTokens: limit}}
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		ContextWithModel(context.Background(), "anthropic/claude-3.5-sonnet"),
+	} {
+		if _, err := collect(m.GenerateContent(ctx, req, false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got := len(fake.requests[0].Messages); got != 6 {
+		t.Errorf("expected the full history for the configured model, got %d messages", got)
+	}
+	if got := len(fake.requests[1].Messages); got >= 6 {
+		t.Errorf("expected the Claude override to drop the oldest history, got %d messages", got)
+	}
+}
+
+func TestConvertRequest_MaxContextTokensKeepsSystemAndLatestUser(t *testing.T) {
+	req := historyRequest(
+		"Old question",
+		"Old answer",
+		"Latest question that must survive",
+	)
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxContextTokens: 1}}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Messages) != 2 {
+		t.Fatalf("expected system and latest user messages only, got %d messages", len(result.Messages))
+	}
+	if result.Messages[0].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("expected system message to be retained, got %q", result.Messages[0].Role)
+	}
+	if result.Messages[1].Content != "Latest question that must survive" {
+		t.Errorf("expected latest user message to be retained, got %q", result.Messages[1].Content)
+	}
+}
+
+func TestConvertRequest_MaxContextTokensUnderLimit(t *testing.T) {
+	req := historyRequest("Hello", "Hi!", "How are you?")
+	m := &OpenRouterModel{modelName: "test-model", cfg: OpenRouterConfig{MaxContextTokens: 10000}}
+
+	result, err := m.convertRequest(req, m.modelName)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Messages) != 4 {
+		t.Errorf("expected no truncation, got %d messages", len(result.Messages))
+	}
+}
+
+func TestTruncateMessages_DropsOrphanedToolResults(t *testing.T) {
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "What's the weather in Paris and London?"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+			{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"London"}`}},
+		}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: `{"temp":20}`},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_2", Content: `{"temp":15}`},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Paris is 20C and London is 15C."},
+		{Role: openai.ChatMessageRoleUser, Content: "Thanks!"},
+	}
+	// Budget only fits the last two messages after dropping the first two
+	budget := countMessagesTokens(messages[4:]) + countMessageTokens(messages[2])
+
+	result := truncateMessages(messages, budget)
+
+	for _, msg := range result {
+		if msg.Role == openai.ChatMessageRoleTool {
+			t.Errorf("expected orphaned tool result %q to be dropped", msg.ToolCallID)
+		}
+	}
+	if len(result) != 2 {
+		t.Errorf("expected 2 messages to remain, got %d", len(result))
+	}
+}
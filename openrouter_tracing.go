@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/adk/model"
+)
+
+// generateSpanName is the name of the span wrapping each GenerateContent call.
+const generateSpanName = "openrouter.generate"
+
+// Span attribute keys recorded on generateSpanName spans.
+const (
+	attrModel            = attribute.Key("openrouter.model")
+	attrStream           = attribute.Key("openrouter.stream")
+	attrPromptTokens     = attribute.Key("openrouter.usage.prompt_tokens")
+	attrCompletionTokens = attribute.Key("openrouter.usage.completion_tokens")
+	attrFinishReason     = attribute.Key("openrouter.finish_reason")
+)
+
+// startSpan starts the span for a GenerateContent call. Without a configured
+// Tracer the span is a no-op.
+func (m *OpenRouterModel) startSpan(ctx context.Context, stream bool) (context.Context, trace.Span) {
+	tracer := m.cfg.Tracer
+	if tracer == nil {
+		tracer = noop.Tracer{}
+	}
+	return tracer.Start(ctx, generateSpanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrModel.String(m.requestModel(ctx)),
+			attrStream.Bool(stream),
+		),
+	)
+}
+
+// tracedYield wraps yield so that errors are recorded on span and the final
+// response's finish reason and token usage are added as attributes.
+func tracedYield(span trace.Span, yield func(*model.LLMResponse, error) bool) func(*model.LLMResponse, error) bool {
+	return func(resp *model.LLMResponse, err error) bool {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if resp != nil && !resp.Partial {
+			span.SetAttributes(attrFinishReason.String(string(resp.FinishReason)))
+			if usage := resp.UsageMetadata; usage != nil {
+				span.SetAttributes(
+					attrPromptTokens.Int(int(usage.PromptTokenCount)),
+					attrCompletionTokens.Int(int(usage.CandidatesTokenCount)),
+				)
+			}
+		}
+		return yield(resp, err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttrs flattens a span's attributes into a map keyed by attribute key.
+func spanAttrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// ============================================================================
+// Tracing Tests
+// ============================================================================
+
+func TestTracing_NonStreamingSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	resp := textCompletion("Hello!", openai.FinishReasonStop)
+	resp.Usage = openai.Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9}
+	m := &OpenRouterModel{
+		chat:      &fakeChatClient{completions: []fakeCompletion{{resp: resp}}},
+		modelName: "openai/gpt-4",
+		cfg:       OpenRouterConfig{Tracer: provider.Tracer("test")},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name() != "openrouter.generate" {
+		t.Errorf("expected span name 'openrouter.generate', got %q", spans[0].Name())
+	}
+
+	attrs := spanAttrs(spans[0])
+	if got := attrs[attrModel].AsString(); got != "openai/gpt-4" {
+		t.Errorf("expected model attribute 'openai/gpt-4', got %q", got)
+	}
+	if got := attrs[attrStream].AsBool(); got {
+		t.Error("expected stream attribute false")
+	}
+	if got := attrs[attrPromptTokens].AsInt64(); got != 7 {
+		t.Errorf("expected prompt tokens 7, got %d", got)
+	}
+	if got := attrs[attrCompletionTokens].AsInt64(); got != 2 {
+		t.Errorf("expected completion tokens 2, got %d", got)
+	}
+	if got := attrs[attrFinishReason].AsString(); got != "STOP" {
+		t.Errorf("expected finish reason 'STOP', got %q", got)
+	}
+}
+
+func TestTracing_RecordsError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	m := &OpenRouterModel{
+		chat:      &fakeChatClient{completions: []fakeCompletion{{resp: openai.ChatCompletionResponse{}}}},
+		modelName: "openai/gpt-4",
+		cfg:       OpenRouterConfig{Tracer: provider.Tracer("test")},
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err == nil {
+		t.Fatal("expected error for response with no choices")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if !spanAttrs(spans[0])[attrStream].AsBool() {
+		t.Error("expected stream attribute true on streaming span")
+	}
+	failed := spans[1]
+	if failed.Status().Code != codes.Error {
+		t.Errorf("expected error status, got %v", failed.Status().Code)
+	}
+	if len(failed.Events()) == 0 || failed.Events()[0].Name != "exception" {
+		t.Errorf("expected recorded exception event, got %v", failed.Events())
+	}
+}
+
+func TestTracing_NoTracerConfigured(t *testing.T) {
+	m := &OpenRouterModel{
+		chat:      &fakeChatClient{completions: []fakeCompletion{{resp: textCompletion("ok", openai.FinishReasonStop)}}},
+		modelName: "openai/gpt-4",
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("expected no-op tracing without a Tracer, got %v", err)
+	}
+}
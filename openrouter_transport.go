@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// openRouterTransport decorates outgoing requests with OpenRouter-specific
+// headers and request fields before handing them to the underlying transport,
+// and inspects responses for data go-openai does not decode.
+type openRouterTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+	// ownsBase is set when base was created for this model rather than
+	// shared or supplied by the caller, so its connections are ours to close.
+	ownsBase bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *openRouterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	state := callStateFrom(req.Context())
+	hasBody := state != nil && state.editsBody() && req.Body != nil
+	hasHeaders := state != nil && len(state.headers) > 0
+
+	if len(t.headers) > 0 || hasBody || hasHeaders {
+		req = req.Clone(req.Context())
+		for key, values := range t.headers {
+			req.Header[key] = values
+		}
+		// Per-request headers win over the configured ones
+		if hasHeaders {
+			for key, values := range state.headers {
+				req.Header[http.CanonicalHeaderKey(key)] = values
+			}
+		}
+		if hasBody {
+			if err := rewriteRequestBody(req, state.editBody); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || state == nil {
+		return resp, err
+	}
+	state.inspect(resp)
+	return resp, nil
+}
+
+// CloseIdleConnections closes idle connections of the underlying transport,
+// when the model created it and it supports it.
+func (t *openRouterTransport) CloseIdleConnections() {
+	if !t.ownsBase {
+		return
+	}
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// callState carries per-call data between GenerateContent and
+// openRouterTransport through the request context.
+type callState struct {
+	// body holds top-level fields merged into the JSON request body.
+	body map[string]any
+	// headers are set on the outgoing request, over the configured ones.
+	headers http.Header
+	// cacheSystem marks the leading system message as cacheable.
+	cacheSystem bool
+	// inputAudio expands the request's input_audio parts.
+	inputAudio bool
+	// cost is the call's cost in credits, when OpenRouter reported one.
+	cost *float64
+	// providerErr holds upstream provider details from an error response.
+	providerErr *ProviderError
+	// audio accumulates audio output returned by the model.
+	audio *responseAudio
+	// citations collects URL citations annotated on the response.
+	citations []*genai.Citation
+	// rateLimit receives the rate-limit headers of each response.
+	rateLimit *rateLimitTracker
+}
+
+type callStateKey struct{}
+
+// withCallState returns a copy of ctx carrying state.
+func withCallState(ctx context.Context, state *callState) context.Context {
+	return context.WithValue(ctx, callStateKey{}, state)
+}
+
+// idempotencyKeyHeader lets the server recognise a retried call as a repeat.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+type requestHeadersKey struct{}
+
+// ContextWithHeaders returns a copy of ctx carrying HTTP headers for calls
+// made with it. They are sent in addition to, and take precedence over, the
+// headers derived from the model's configuration (such as X-Title).
+func ContextWithHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, requestHeadersKey{}, headers.Clone())
+}
+
+// requestHeadersFrom returns the headers attached by ContextWithHeaders, or nil.
+func requestHeadersFrom(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(requestHeadersKey{}).(http.Header)
+	return headers
+}
+
+// callStateFrom returns the callState carried by ctx, or nil.
+func callStateFrom(ctx context.Context) *callState {
+	state, _ := ctx.Value(callStateKey{}).(*callState)
+	return state
+}
+
+// editsBody reports whether the JSON request body needs rewriting.
+func (s *callState) editsBody() bool {
+	return len(s.body) > 0 || s.cacheSystem || s.inputAudio
+}
+
+// editBody applies the call's edits to a decoded JSON request body.
+func (s *callState) editBody(body map[string]json.RawMessage) error {
+	if err := mergeFields(body, s.body); err != nil {
+		return err
+	}
+	if s.cacheSystem {
+		if err := markSystemCacheable(body); err != nil {
+			return err
+		}
+	}
+	if s.inputAudio {
+		return expandAudioParts(body)
+	}
+	return nil
+}
+
+// inspect records OpenRouter-specific fields from a successful response.
+// Event streams are observed as they are read; other bodies are buffered.
+func (s *callState) inspect(resp *http.Response) {
+	if s.rateLimit != nil {
+		if info, ok := parseRateLimit(resp.Header); ok {
+			s.rateLimit.store(info)
+		}
+	}
+	if resp.Body == nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		if data, ok := bufferBody(resp); ok {
+			s.observeError(data)
+		}
+		return
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = &lineReader{
+			src:    bufio.NewReader(resp.Body),
+			closer: resp.Body,
+			fn:     s.observeEvent,
+		}
+		return
+	}
+
+	if data, ok := bufferBody(resp); ok {
+		s.observe(data)
+		if normalized, ok := normalizeReasoning(data, "message"); ok {
+			resp.Body = io.NopCloser(bytes.NewReader(normalized))
+			resp.ContentLength = int64(len(normalized))
+		}
+	}
+}
+
+// bufferBody reads the whole response body and replaces it with an in-memory
+// copy, so it can still be decoded by go-openai. A read error is replayed to
+// the caller after the data read so far.
+func bufferBody(resp *http.Response) ([]byte, bool) {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), errReader{err}))
+		return nil, false
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return data, true
+}
+
+// observeEvent records fields from a single "data:" line of an event stream.
+func (s *callState) observeEvent(line []byte) []byte {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return line
+	}
+	payload = bytes.TrimSpace(payload)
+	s.observe(payload)
+	// Errors after the stream has started arrive as events
+	s.observeError(payload)
+
+	if normalized, ok := normalizeReasoning(payload, "delta"); ok {
+		return append(append([]byte("data: "), normalized...), '\n')
+	}
+	return line
+}
+
+// observe records fields from a JSON completion or completion chunk.
+func (s *callState) observe(payload []byte) {
+	var body struct {
+		Choices []struct {
+			Message *struct {
+				Audio       *audioPayload `json:"audio"`
+				Annotations []annotation  `json:"annotations"`
+			} `json:"message"`
+			Delta *struct {
+				Audio       *audioPayload `json:"audio"`
+				Annotations []annotation  `json:"annotations"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *struct {
+			Cost *float64 `json:"cost"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return
+	}
+	if body.Usage != nil && body.Usage.Cost != nil {
+		s.cost = body.Usage.Cost
+	}
+	if len(body.Choices) > 0 {
+		choice := body.Choices[0]
+		var audio *audioPayload
+		var annotations []annotation
+		if choice.Message != nil {
+			audio, annotations = choice.Message.Audio, choice.Message.Annotations
+		} else if choice.Delta != nil {
+			audio, annotations = choice.Delta.Audio, choice.Delta.Annotations
+		}
+		for _, a := range annotations {
+			if a.Type == "url_citation" && a.URLCitation != nil {
+				s.citations = append(s.citations, a.URLCitation.citation())
+			}
+		}
+		if audio != nil {
+			if s.audio == nil {
+				s.audio = &responseAudio{}
+			}
+			s.audio.add(audio)
+		}
+	}
+}
+
+// annotation is an entry of a message's annotations, such as a URL citation
+// added by the web search plugin.
+type annotation struct {
+	Type        string       `json:"type"`
+	URLCitation *urlCitation `json:"url_citation"`
+}
+
+type urlCitation struct {
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	StartIndex int32  `json:"start_index"`
+	EndIndex   int32  `json:"end_index"`
+}
+
+func (c *urlCitation) citation() *genai.Citation {
+	return &genai.Citation{
+		URI:        c.URL,
+		Title:      c.Title,
+		StartIndex: c.StartIndex,
+		EndIndex:   c.EndIndex,
+	}
+}
+
+// rewriteRequestBody decodes the JSON body of req, passes it to edit and
+// re-encodes the result.
+func rewriteRequestBody(req *http.Request, edit func(body map[string]json.RawMessage) error) error {
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("failed to decode request body: %w", err)
+	}
+	if err := edit(body); err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// expandAudioParts rewrites input_audio content parts, whose text holds the
+// encoded input_audio object, into the shape the API expects.
+func expandAudioParts(body map[string]json.RawMessage) error {
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(body["messages"], &messages); err != nil {
+		return nil
+	}
+
+	for _, msg := range messages {
+		var parts []map[string]json.RawMessage
+		if err := json.Unmarshal(msg["content"], &parts); err != nil {
+			continue
+		}
+		expanded := false
+		for _, part := range parts {
+			var partType, text string
+			if json.Unmarshal(part["type"], &partType) != nil || partType != string(chatMessagePartTypeInputAudio) {
+				continue
+			}
+			if json.Unmarshal(part["text"], &text) != nil {
+				continue
+			}
+			delete(part, "text")
+			part["input_audio"] = json.RawMessage(text)
+			expanded = true
+		}
+		if !expanded {
+			continue
+		}
+		data, err := json.Marshal(parts)
+		if err != nil {
+			return fmt.Errorf("failed to encode audio parts: %w", err)
+		}
+		msg["content"] = data
+	}
+
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return fmt.Errorf("failed to encode messages: %w", err)
+	}
+	body["messages"] = data
+	return nil
+}
+
+// beginAttempt clears what a previous attempt of the call recorded about its
+// error, so a retry failing for another reason isn't reported with it.
+func (s *callState) beginAttempt() {
+	if s != nil {
+		s.providerErr = nil
+	}
+}
+
+// observeError records the upstream provider details OpenRouter attaches to
+// error responses under error.metadata.
+func (s *callState) observeError(payload []byte) {
+	var body struct {
+		Error struct {
+			Metadata *struct {
+				ProviderName string          `json:"provider_name"`
+				Raw          json.RawMessage `json:"raw"`
+			} `json:"metadata"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil || body.Error.Metadata == nil {
+		return
+	}
+	meta := body.Error.Metadata
+	s.providerErr = &ProviderError{
+		Provider: meta.ProviderName,
+		Raw:      rawString(meta.Raw),
+	}
+}
+
+// rawString renders raw as plain text when it is a JSON string and as
+// compact JSON otherwise.
+func rawString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+// normalizeReasoning copies OpenRouter's "reasoning" field into the
+// "reasoning_content" field go-openai decodes, for each choice's message or
+// delta (selected by key). It reports whether payload was changed.
+func normalizeReasoning(payload []byte, key string) ([]byte, bool) {
+	if !bytes.Contains(payload, []byte(`"reasoning"`)) {
+		return nil, false
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, false
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(body["choices"], &choices); err != nil {
+		return nil, false
+	}
+
+	changed := false
+	for _, choice := range choices {
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(choice[key], &msg); err != nil || msg == nil {
+			continue
+		}
+		var reasoning string
+		if json.Unmarshal(msg["reasoning"], &reasoning) != nil || reasoning == "" {
+			continue
+		}
+		if _, ok := msg["reasoning_content"]; ok {
+			continue
+		}
+		msg["reasoning_content"] = msg["reasoning"]
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, false
+		}
+		choice[key] = data
+		changed = true
+	}
+	if !changed {
+		return nil, false
+	}
+
+	data, err := json.Marshal(choices)
+	if err != nil {
+		return nil, false
+	}
+	body["choices"] = data
+	normalized, err := json.Marshal(body)
+	if err != nil {
+		return nil, false
+	}
+	return normalized, true
+}
+
+// mergeFields adds extra to body, keeping any field body already has.
+func mergeFields(body map[string]json.RawMessage, extra map[string]any) error {
+	for key, value := range extra {
+		if _, ok := body[key]; ok {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request field %q: %w", key, err)
+		}
+		body[key] = raw
+	}
+	return nil
+}
+
+// markSystemCacheable rewrites a leading system message with plain string
+// content into a single text part carrying an ephemeral cache_control marker.
+func markSystemCacheable(body map[string]json.RawMessage) error {
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(body["messages"], &messages); err != nil || len(messages) == 0 {
+		return nil
+	}
+
+	var role, content string
+	if json.Unmarshal(messages[0]["role"], &role) != nil || role != "system" {
+		return nil
+	}
+	if json.Unmarshal(messages[0]["content"], &content) != nil || content == "" {
+		return nil
+	}
+
+	parts, err := json.Marshal([]map[string]any{{
+		"type":          "text",
+		"text":          content,
+		"cache_control": map[string]string{"type": "ephemeral"},
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to encode cacheable system message: %w", err)
+	}
+	messages[0]["content"] = parts
+
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return fmt.Errorf("failed to encode messages: %w", err)
+	}
+	body["messages"] = data
+	return nil
+}
+
+// lineReader passes a response body through fn one line at a time.
+type lineReader struct {
+	src     *bufio.Reader
+	closer  io.Closer
+	fn      func(line []byte) []byte
+	pending []byte
+	err     error
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.src.ReadBytes('\n')
+		if len(line) > 0 {
+			r.pending = r.fn(line)
+		}
+		r.err = err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *lineReader) Close() error {
+	return r.closer.Close()
+}
+
+// errReader is a reader that always fails with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// newHTTPClient builds the HTTP client handed to the OpenAI client. It copies
+// the configured client (so the caller's value is never mutated), applies the
+// timeout and InsecureSkipVerify, and wraps its transport with
+// openRouterTransport.
+func newHTTPClient(cfg OpenRouterConfig) *http.Client {
+	httpClient := &http.Client{}
+	if cfg.HTTPClient != nil {
+		clone := *cfg.HTTPClient
+		httpClient = &clone
+	}
+	if cfg.Timeout > 0 {
+		httpClient.Timeout = cfg.Timeout
+	}
+
+	base := httpClient.Transport
+	ownsBase := false
+	if base == nil {
+		// A private copy of the default transport keeps Close from dropping
+		// the idle connections of every other client in the process
+		base = http.DefaultTransport
+		if transport, ok := base.(*http.Transport); ok {
+			base, ownsBase = transport.Clone(), true
+		}
+	}
+	if cfg.InsecureSkipVerify && cfg.HTTPClient == nil {
+		base, ownsBase = insecureTransport(), true
+	}
+	httpClient.Transport = &openRouterTransport{
+		base:     base,
+		headers:  openRouterHeaders(cfg),
+		ownsBase: ownsBase,
+	}
+	return httpClient
+}
+
+// insecureTransport returns a copy of http.DefaultTransport that accepts any
+// server certificate.
+func insecureTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	return transport
+}
+
+// openRouterHeaders returns the app attribution headers OpenRouter reads.
+func openRouterHeaders(cfg OpenRouterConfig) http.Header {
+	headers := make(http.Header)
+	if cfg.SiteURL != "" {
+		headers.Set("HTTP-Referer", cfg.SiteURL)
+	}
+	if cfg.AppName != "" {
+		headers.Set("X-Title", cfg.AppName)
+	}
+	return headers
+}
@@ -0,0 +1,1291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// newStubServer starts an httptest server that records each request and
+// replies with body as a JSON chat completion.
+func newStubServer(t *testing.T, body string, record func(*http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if record != nil {
+			record(r)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+const stubCompletion = `{"id":"gen-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`
+
+// ============================================================================
+// Transport Tests
+// ============================================================================
+
+func TestTransport_AttributionHeaders(t *testing.T) {
+	var got http.Header
+	server := newStubServer(t, stubCompletion, func(r *http.Request) {
+		got = r.Header.Clone()
+	})
+
+	m, err := NewOpenRouterModel("openai/gpt-4", &OpenRouterConfig{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+		SiteURL: "https://example.com",
+		AppName: "My Agent",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = m.client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "openai/gpt-4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Get("HTTP-Referer") != "https://example.com" {
+		t.Errorf("expected HTTP-Referer header, got %q", got.Get("HTTP-Referer"))
+	}
+	if got.Get("X-Title") != "My Agent" {
+		t.Errorf("expected X-Title header, got %q", got.Get("X-Title"))
+	}
+	if got.Get("Authorization") != "Bearer test-api-key" {
+		t.Errorf("expected bearer auth header, got %q", got.Get("Authorization"))
+	}
+}
+
+func TestTransport_CustomBasePath(t *testing.T) {
+	var gotPath string
+	server := newStubServer(t, stubCompletion, func(r *http.Request) {
+		gotPath = r.URL.Path
+	})
+
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL+"/proxy/openrouter"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = m.client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "openai/gpt-4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotPath != "/proxy/openrouter/chat/completions" {
+		t.Errorf("expected request path under the custom base path, got %q", gotPath)
+	}
+}
+
+func TestTransport_NoAttributionHeaders(t *testing.T) {
+	var got http.Header
+	server := newStubServer(t, stubCompletion, func(r *http.Request) {
+		got = r.Header.Clone()
+	})
+
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = m.client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "openai/gpt-4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := got["Http-Referer"]; ok {
+		t.Errorf("expected no HTTP-Referer header, got %q", got.Get("HTTP-Referer"))
+	}
+	if _, ok := got["X-Title"]; ok {
+		t.Errorf("expected no X-Title header, got %q", got.Get("X-Title"))
+	}
+}
+
+func TestTransport_PerRequestHeaders(t *testing.T) {
+	var got []http.Header
+	server := newStubServer(t, stubCompletion, func(r *http.Request) {
+		got = append(got, r.Header.Clone())
+	})
+	m, err := NewOpenRouterModel("openai/gpt-4", &OpenRouterConfig{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+		SiteURL: "https://example.com",
+		AppName: "My Agent",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := ContextWithHeaders(context.Background(), http.Header{
+		"X-Title":     {"Summarizer Agent"},
+		"x-trace-tag": {"nightly"},
+	})
+	if _, err := collect(m.GenerateContent(ctx, userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got[0].Get("X-Title") != "Summarizer Agent" {
+		t.Errorf("expected per-request X-Title to override the config, got %q", got[0].Values("X-Title"))
+	}
+	if got[0].Get("X-Trace-Tag") != "nightly" {
+		t.Errorf("expected per-request header to be added, got %q", got[0].Get("X-Trace-Tag"))
+	}
+	if got[0].Get("HTTP-Referer") != "https://example.com" {
+		t.Errorf("expected configured headers to be kept, got %q", got[0].Get("HTTP-Referer"))
+	}
+	if got[1].Get("X-Title") != "My Agent" || got[1].Get("X-Trace-Tag") != "" {
+		t.Errorf("expected the next call to use config headers only, got %v", got[1])
+	}
+}
+
+func TestTransport_IdempotencyKey(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.Header().Set("Content-Type", "application/json")
+		if len(keys) == 1 {
+			// An empty answer makes the first attempt retryable
+			_, _ = w.Write([]byte(`{"id":"gen-1","choices":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(stubCompletion))
+	}))
+	t.Cleanup(server.Close)
+	m, err := NewOpenRouterModel("openai/gpt-4", &OpenRouterConfig{
+		APIKey:          "test-api-key",
+		BaseURL:         server.URL,
+		IdempotencyKeys: true,
+		Retryer: retryerFunc(func(attempt int, err error) (time.Duration, bool) {
+			return 0, attempt < 2
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(keys))
+	}
+	if keys[0] == "" {
+		t.Fatal("expected an Idempotency-Key header")
+	}
+	if keys[1] != keys[0] {
+		t.Errorf("expected the retry to reuse key %q, got %q", keys[0], keys[1])
+	}
+	if keys[2] == keys[0] {
+		t.Error("expected a new call to get a new key")
+	}
+}
+
+func TestTransport_IdempotencyKeyFromContext(t *testing.T) {
+	var got string
+	server := newStubServer(t, stubCompletion, func(r *http.Request) {
+		got = r.Header.Get("Idempotency-Key")
+	})
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithIdempotencyKeys())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := ContextWithHeaders(context.Background(), http.Header{"Idempotency-Key": {"order-42"}})
+	if _, err := collect(m.GenerateContent(ctx, userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got != "order-42" {
+		t.Errorf("expected the caller's key to be kept, got %q", got)
+	}
+}
+
+func TestNewHTTPClient_InsecureSkipVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  OpenRouterConfig
+		want bool
+	}{
+		{"enabled", OpenRouterConfig{InsecureSkipVerify: true}, true},
+		{"disabled", OpenRouterConfig{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpClient := newHTTPClient(tt.cfg)
+
+			base, ok := httpClient.Transport.(*openRouterTransport).base.(*http.Transport)
+			if !ok {
+				t.Fatalf("expected an *http.Transport base, got %T", httpClient.Transport.(*openRouterTransport).base)
+			}
+			got := base.TLSClientConfig != nil && base.TLSClientConfig.InsecureSkipVerify
+			if got != tt.want {
+				t.Errorf("expected InsecureSkipVerify %v, got %v", tt.want, got)
+			}
+		})
+	}
+	if defaultTLS := http.DefaultTransport.(*http.Transport).TLSClientConfig; defaultTLS != nil && defaultTLS.InsecureSkipVerify {
+		t.Error("expected http.DefaultTransport not to be mutated")
+	}
+}
+
+func TestNewHTTPClient_InsecureSkipVerifyIgnoredWithCustomClient(t *testing.T) {
+	custom := &http.Transport{}
+	httpClient := newHTTPClient(OpenRouterConfig{
+		HTTPClient:         &http.Client{Transport: custom},
+		InsecureSkipVerify: true,
+	})
+
+	if base := httpClient.Transport.(*openRouterTransport).base; base != custom {
+		t.Errorf("expected the custom client's transport to be kept, got %T", base)
+	}
+	if custom.TLSClientConfig != nil {
+		t.Error("expected the custom transport not to be modified")
+	}
+}
+
+func TestTransport_InsecureSkipVerifySelfSigned(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(stubCompletion))
+	}))
+	t.Cleanup(server.Close)
+
+	strict, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(strict.GenerateContent(context.Background(), userRequest("Hi"), false)); err == nil {
+		t.Error("expected the self-signed certificate to be rejected by default")
+	}
+
+	insecure, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(insecure.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Errorf("expected the self-signed certificate to be accepted, got %v", err)
+	}
+}
+
+// closeRecorder is an http.RoundTripper that counts CloseIdleConnections calls.
+type closeRecorder struct {
+	http.RoundTripper
+	closed int
+}
+
+func (r *closeRecorder) CloseIdleConnections() {
+	r.closed++
+}
+
+func TestClose_ClosesOwnTransport(t *testing.T) {
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	transport := m.httpClient.Transport.(*openRouterTransport)
+	if !transport.ownsBase || transport.base == http.DefaultTransport {
+		t.Errorf("expected the model to own a private transport, got %T (owned: %v)", transport.base, transport.ownsBase)
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("expected nil from Close, got %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("expected nil from a second Close, got %v", err)
+	}
+}
+
+func TestClose_LeavesCallerTransport(t *testing.T) {
+	base := &closeRecorder{RoundTripper: http.DefaultTransport}
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithHTTPClient(&http.Client{Transport: base}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("expected nil from Close, got %v", err)
+	}
+	if base.closed != 0 {
+		t.Errorf("expected the caller's transport to be left alone, got %d closes", base.closed)
+	}
+}
+
+func TestClose_UsableAfterClose(t *testing.T) {
+	server := newStubServer(t, stubCompletion, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("expected nil from Close, got %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi again"), false)); err != nil {
+		t.Errorf("expected the model to keep working after Close, got %v", err)
+	}
+}
+
+func TestClose_WithoutHTTPClient(t *testing.T) {
+	m := &OpenRouterModel{}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("expected nil from Close, got %v", err)
+	}
+}
+
+// newSSEServer starts an httptest server that replies with events as a
+// server-sent event stream terminated by [DONE].
+func newSSEServer(t *testing.T, events []string, record func(*http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if record != nil {
+			record(r)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// decodeBody decodes a recorded JSON request body into a map.
+func decodeBody(t *testing.T, r *http.Request) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode request body: %v", err)
+	}
+	return body
+}
+
+// ============================================================================
+// Cost Tests
+// ============================================================================
+
+func TestCost_NonStreaming(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t,
+		`{"id":"gen-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12,"cost":0.00042}}`,
+		func(r *http.Request) { body = decodeBody(t, r) },
+	)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithIncludeCost())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	usage, ok := body["usage"].(map[string]any)
+	if !ok || usage["include"] != true {
+		t.Errorf("expected usage.include=true in request body, got %v", body["usage"])
+	}
+	cost, ok := ResponseCost(responses[0])
+	if !ok {
+		t.Fatal("expected cost to be captured")
+	}
+	if cost != 0.00042 {
+		t.Errorf("expected cost 0.00042, got %v", cost)
+	}
+	if responses[0].UsageMetadata == nil || responses[0].UsageMetadata.TotalTokenCount != 12 {
+		t.Errorf("expected token usage to still be decoded, got %+v", responses[0].UsageMetadata)
+	}
+}
+
+func TestCost_Streaming(t *testing.T) {
+	server := newSSEServer(t, []string{
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"gen-1","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11,"cost":0.001}}`,
+	}, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithIncludeCost())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	final := responses[len(responses)-1]
+	if cost, ok := ResponseCost(final); !ok || cost != 0.001 {
+		t.Errorf("expected streamed cost 0.001, got %v (ok=%v)", cost, ok)
+	}
+	if final.Content.Parts[0].Text != "hi" {
+		t.Errorf("expected streamed text to be intact, got %q", final.Content.Parts[0].Text)
+	}
+}
+
+func TestCost_NotRequested(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := body["usage"]; ok {
+		t.Errorf("expected no usage field in request body, got %v", body["usage"])
+	}
+	if _, ok := ResponseCost(responses[0]); ok {
+		t.Error("expected no cost without a cost payload")
+	}
+}
+
+// ============================================================================
+// Generation ID Tests
+// ============================================================================
+
+func TestGenerationID_NonStreaming(t *testing.T) {
+	server := newStubServer(t, stubCompletion, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id := m.LastGenerationID(); id != "" {
+		t.Errorf("expected no generation ID before any call, got %q", id)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if id, ok := ResponseGenerationID(responses[0]); !ok || id != "gen-1" {
+		t.Errorf("expected generation ID gen-1 on the response, got %q (ok=%v)", id, ok)
+	}
+	if id := m.LastGenerationID(); id != "gen-1" {
+		t.Errorf("expected LastGenerationID gen-1, got %q", id)
+	}
+}
+
+func TestGenerationID_Streaming(t *testing.T) {
+	server := newSSEServer(t, []string{
+		`{"id":"gen-stream-7","choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+		`{"id":"gen-stream-7","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	}, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	final := responses[len(responses)-1]
+	if id, ok := ResponseGenerationID(final); !ok || id != "gen-stream-7" {
+		t.Errorf("expected generation ID on the final response, got %q (ok=%v)", id, ok)
+	}
+	if id := m.LastGenerationID(); id != "gen-stream-7" {
+		t.Errorf("expected LastGenerationID gen-stream-7, got %q", id)
+	}
+}
+
+// ============================================================================
+// Sampling Parameter Tests
+// ============================================================================
+
+func TestSamplingParams_RequestBody(t *testing.T) {
+	params := []string{"min_p", "top_a", "repetition_penalty"}
+	tests := []struct {
+		name string
+		opts []Option
+		want map[string]float64
+	}{
+		{
+			name: "none configured",
+			want: map[string]float64{},
+		},
+		{
+			name: "min_p only",
+			opts: []Option{WithMinP(0.1)},
+			want: map[string]float64{"min_p": 0.1},
+		},
+		{
+			name: "top_a only",
+			opts: []Option{WithTopA(0.5)},
+			want: map[string]float64{"top_a": 0.5},
+		},
+		{
+			name: "repetition_penalty only",
+			opts: []Option{WithRepetitionPenalty(1.25)},
+			want: map[string]float64{"repetition_penalty": 1.25},
+		},
+		{
+			name: "all configured",
+			opts: []Option{WithMinP(0.05), WithTopA(0), WithRepetitionPenalty(1.1)},
+			want: map[string]float64{"min_p": 0.05, "top_a": 0, "repetition_penalty": 1.1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+			opts := append([]Option{WithAPIKey("test-api-key"), WithBaseURL(server.URL)}, tt.opts...)
+			m, err := NewOpenRouterModel("openai/gpt-4", opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, param := range params {
+				want, configured := tt.want[param]
+				got, present := body[param]
+				if present != configured {
+					t.Errorf("%s: expected present=%v, got %v", param, configured, body[param])
+					continue
+				}
+				if configured && got != want {
+					t.Errorf("%s: expected %v, got %v", param, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTransforms_RequestBody(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithTransforms("middle-out"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	transforms, ok := body["transforms"].([]any)
+	if !ok || len(transforms) != 1 || transforms[0] != "middle-out" {
+		t.Errorf("expected transforms [middle-out], got %v", body["transforms"])
+	}
+}
+
+func TestTransforms_OmittedByDefault(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := body["transforms"]; ok {
+		t.Errorf("expected no transforms field, got %v", body["transforms"])
+	}
+}
+
+// ============================================================================
+// Plugin Tests
+// ============================================================================
+
+func TestPlugins_RequestBody(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4",
+		WithAPIKey("test-api-key"),
+		WithBaseURL(server.URL),
+		WithWebSearch(3),
+		WithPlugins(Plugin{ID: "file-parser"}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Latest news?"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	plugins, ok := body["plugins"].([]any)
+	if !ok || len(plugins) != 2 {
+		t.Fatalf("expected 2 plugins, got %v", body["plugins"])
+	}
+	web := plugins[0].(map[string]any)
+	if web["id"] != "web" || web["max_results"] != 3.0 {
+		t.Errorf("unexpected web plugin: %v", web)
+	}
+	parser := plugins[1].(map[string]any)
+	if len(parser) != 1 || parser["id"] != "file-parser" {
+		t.Errorf("expected unset plugin fields to be omitted, got %v", parser)
+	}
+	if body["model"] != "openai/gpt-4" {
+		t.Errorf("expected the model name to be unchanged, got %v", body["model"])
+	}
+}
+
+func TestPlugins_OmittedByDefault(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := body["plugins"]; ok {
+		t.Errorf("expected no plugins field, got %v", body["plugins"])
+	}
+}
+
+func TestCitations_NonStreaming(t *testing.T) {
+	server := newStubServer(t,
+		`{"id":"gen-1","choices":[{"index":0,"message":{"role":"assistant","content":"Go 1.25 is out.","annotations":[`+
+			`{"type":"url_citation","url_citation":{"url":"https://go.dev/doc/go1.25","title":"Go 1.25 Release Notes","content":"...","start_index":0,"end_index":15}},`+
+			`{"type":"file","file":{"name":"notes.pdf"}}]},"finish_reason":"stop"}]}`,
+		nil,
+	)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithWebSearch(0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Latest Go?"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	meta := responses[0].CitationMetadata
+	if meta == nil || len(meta.Citations) != 1 {
+		t.Fatalf("expected 1 citation, got %+v", meta)
+	}
+	c := meta.Citations[0]
+	if c.URI != "https://go.dev/doc/go1.25" || c.Title != "Go 1.25 Release Notes" || c.StartIndex != 0 || c.EndIndex != 15 {
+		t.Errorf("unexpected citation: %+v", c)
+	}
+	if responses[0].Content.Parts[0].Text != "Go 1.25 is out." {
+		t.Errorf("expected text to be intact, got %q", responses[0].Content.Parts[0].Text)
+	}
+}
+
+func TestCitations_Streaming(t *testing.T) {
+	server := newSSEServer(t, []string{
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"content":"Go 1.25 is out."}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"annotations":[{"type":"url_citation","url_citation":{"url":"https://go.dev/doc/go1.25","title":"Go 1.25"}}]},"finish_reason":"stop"}]}`,
+	}, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Latest Go?"), true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	final := responses[len(responses)-1]
+	if final.CitationMetadata == nil || len(final.CitationMetadata.Citations) != 1 {
+		t.Fatalf("expected 1 citation on the final response, got %+v", final.CitationMetadata)
+	}
+	if final.CitationMetadata.Citations[0].URI != "https://go.dev/doc/go1.25" {
+		t.Errorf("unexpected citation: %+v", final.CitationMetadata.Citations[0])
+	}
+}
+
+func TestCitations_AbsentByDefault(t *testing.T) {
+	server := newStubServer(t, stubCompletion, nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if responses[0].CitationMetadata != nil {
+		t.Errorf("expected no citation metadata, got %+v", responses[0].CitationMetadata)
+	}
+}
+
+// ============================================================================
+// Extra Body Tests
+// ============================================================================
+
+func TestExtraBody_RequestBody(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4",
+		WithAPIKey("test-api-key"),
+		WithBaseURL(server.URL),
+		WithExtraBody("reasoning", map[string]any{"effort": "high"}),
+		WithExtraBody("model", "other/model"),
+		WithExtraBody("transforms", []string{"ignored"}),
+		WithTransforms("middle-out"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reasoning, ok := body["reasoning"].(map[string]any)
+	if !ok || reasoning["effort"] != "high" {
+		t.Errorf("expected the extra field in the request body, got %v", body["reasoning"])
+	}
+	if body["model"] != "openai/gpt-4" {
+		t.Errorf("expected the wrapper's model to take precedence, got %v", body["model"])
+	}
+	transforms, _ := body["transforms"].([]any)
+	if len(transforms) != 1 || transforms[0] != "middle-out" {
+		t.Errorf("expected configured transforms to take precedence, got %v", body["transforms"])
+	}
+}
+
+// ============================================================================
+// Metadata Tests
+// ============================================================================
+
+func TestMetadata_RequestBody(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4",
+		WithAPIKey("test-api-key"),
+		WithBaseURL(server.URL),
+		WithMetadata("feature", "summarizer"),
+		WithMetadata("tenant", "acme"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	metadata, ok := body["metadata"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected a metadata object in the request body, got %v", body["metadata"])
+	}
+	if metadata["feature"] != "summarizer" || metadata["tenant"] != "acme" {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+}
+
+func TestMetadata_OmittedWhenEmpty(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := body["metadata"]; ok {
+		t.Errorf("expected no metadata field, got %v", body["metadata"])
+	}
+}
+
+// ============================================================================
+// Stop Sequence Tests
+// ============================================================================
+
+func TestStopSequences_RequestBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		stop   []string
+		scalar bool
+		want   any
+	}{
+		{name: "none", stop: nil, want: nil},
+		{name: "only empty strings", stop: []string{"", ""}, want: nil},
+		{name: "one", stop: []string{"END"}, want: []any{"END"}},
+		{name: "one as scalar", stop: []string{"END"}, scalar: true, want: "END"},
+		{name: "many", stop: []string{"END", "", "STOP"}, want: []any{"END", "STOP"}},
+		{name: "many with scalar", stop: []string{"END", "STOP"}, scalar: true, want: []any{"END", "STOP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+			opts := []Option{WithAPIKey("test-api-key"), WithBaseURL(server.URL)}
+			if tt.scalar {
+				opts = append(opts, WithScalarStop())
+			}
+			m, err := NewOpenRouterModel("openai/gpt-4", opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			req := userRequest("Hi")
+			req.Config = &genai.GenerateContentConfig{StopSequences: tt.stop}
+
+			if _, err := collect(m.GenerateContent(context.Background(), req, false)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, present := body["stop"]
+			if tt.want == nil {
+				if present {
+					t.Errorf("expected stop to be omitted, got %v", got)
+				}
+				return
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) || fmt.Sprintf("%T", got) != fmt.Sprintf("%T", tt.want) {
+				t.Errorf("expected stop %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Provider Routing Tests
+// ============================================================================
+
+// providerBlock sends one request with opts and returns the decoded provider
+// object, or nil when the request has none.
+func providerBlock(t *testing.T, opts ...Option) map[string]any {
+	t.Helper()
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	opts = append([]Option{WithAPIKey("test-api-key"), WithBaseURL(server.URL)}, opts...)
+	m, err := NewOpenRouterModel("meta-llama/llama-3-70b", opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["provider"] == nil {
+		return nil
+	}
+	provider, ok := body["provider"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected provider object, got %v", body["provider"])
+	}
+	return provider
+}
+
+func TestProviderRouting_OmittedByDefault(t *testing.T) {
+	if provider := providerBlock(t); provider != nil {
+		t.Errorf("expected no provider block, got %v", provider)
+	}
+}
+
+func TestProviderRouting_DataCollection(t *testing.T) {
+	provider := providerBlock(t, WithDataCollection("deny"))
+
+	if provider["data_collection"] != "deny" {
+		t.Errorf("expected data_collection deny, got %v", provider["data_collection"])
+	}
+}
+
+func TestProviderRouting_Quantizations(t *testing.T) {
+	provider := providerBlock(t, WithQuantizations("fp16", "fp8"))
+
+	quantizations, ok := provider["quantizations"].([]any)
+	if !ok || len(quantizations) != 2 || quantizations[0] != "fp16" || quantizations[1] != "fp8" {
+		t.Errorf("expected quantizations [fp16 fp8], got %v", provider["quantizations"])
+	}
+	if _, ok := provider["data_collection"]; ok {
+		t.Errorf("expected no data_collection when unset, got %v", provider["data_collection"])
+	}
+}
+
+func TestProviderRouting_MaxPrice(t *testing.T) {
+	provider := providerBlock(t, WithMaxPrice(1, 2.5))
+
+	maxPrice, ok := provider["max_price"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected max_price object, got %v", provider["max_price"])
+	}
+	if len(maxPrice) != 2 || maxPrice["prompt"] != 1.0 || maxPrice["completion"] != 2.5 {
+		t.Errorf("expected max_price {prompt: 1, completion: 2.5}, got %v", maxPrice)
+	}
+}
+
+func TestProviderRouting_MaxPricePromptOnly(t *testing.T) {
+	provider := providerBlock(t, optionFunc(func(cfg *OpenRouterConfig) {
+		cfg.MaxPrice = &MaxPrice{Prompt: 0.5}
+	}))
+
+	maxPrice, ok := provider["max_price"].(map[string]any)
+	if !ok || len(maxPrice) != 1 || maxPrice["prompt"] != 0.5 {
+		t.Errorf("expected max_price {prompt: 0.5}, got %v", provider["max_price"])
+	}
+}
+
+func TestProviderRouting_Sort(t *testing.T) {
+	for _, sort := range []string{"price", "throughput", "latency"} {
+		t.Run(sort, func(t *testing.T) {
+			provider := providerBlock(t, WithProviderSort(sort))
+
+			if provider["sort"] != sort {
+				t.Errorf("expected sort %q, got %v", sort, provider["sort"])
+			}
+		})
+	}
+}
+
+func TestProviderRouting_InvalidSort(t *testing.T) {
+	_, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithProviderSort("cheapest"))
+
+	if err == nil {
+		t.Fatal("expected error for an invalid provider sort")
+	}
+}
+
+func TestProviderRouting_Combined(t *testing.T) {
+	provider := providerBlock(t, WithDataCollection("deny"), WithQuantizations("fp16"))
+
+	if provider["data_collection"] != "deny" {
+		t.Errorf("expected data_collection deny, got %v", provider["data_collection"])
+	}
+	if quantizations, ok := provider["quantizations"].([]any); !ok || len(quantizations) != 1 {
+		t.Errorf("expected quantizations [fp16], got %v", provider["quantizations"])
+	}
+}
+
+func TestProviderRouting_InvalidDataCollection(t *testing.T) {
+	_, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithDataCollection("never"))
+
+	if err == nil {
+		t.Fatal("expected error for an invalid data collection policy")
+	}
+}
+
+// ============================================================================
+// Reasoning Tests
+// ============================================================================
+
+func TestReasoning_StreamedReasoningField(t *testing.T) {
+	server := newSSEServer(t, []string{
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"role":"assistant","content":"","reasoning":"Thinking..."}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"content":"Done."},"finish_reason":"stop"}]}`,
+	}, nil)
+	m, err := NewOpenRouterModel("deepseek/deepseek-r1", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("Hi"), true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first := responses[0].Content.Parts[0]; !first.Thought || first.Text != "Thinking..." {
+		t.Errorf("expected a partial thought part, got %+v", first)
+	}
+	final := responses[len(responses)-1]
+	if len(final.Content.Parts) != 2 || !final.Content.Parts[0].Thought || final.Content.Parts[1].Text != "Done." {
+		t.Errorf("expected thought then text in the final response, got %+v", final.Content.Parts)
+	}
+}
+
+func TestReasoning_NonStreamingReasoningOnly(t *testing.T) {
+	server := newStubServer(t,
+		`{"id":"gen-1","choices":[{"index":0,"message":{"role":"assistant","content":"","reasoning":"2+2 is 4."},"finish_reason":"stop"}]}`,
+		nil)
+	m, err := NewOpenRouterModel("deepseek/deepseek-r1", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses, err := collect(m.GenerateContent(context.Background(), userRequest("What is 2+2?"), false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parts := responses[0].Content.Parts
+	if len(parts) != 1 {
+		t.Fatalf("expected a non-empty response, got %d parts", len(parts))
+	}
+	if !parts[0].Thought || parts[0].Text != "2+2 is 4." {
+		t.Errorf("expected the reasoning as a thought part, got %+v", parts[0])
+	}
+	if responses[0].FinishReason != genai.FinishReasonStop {
+		t.Errorf("expected finish reason stop, got %q", responses[0].FinishReason)
+	}
+}
+
+func TestNormalizeReasoning(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "reasoning copied",
+			payload: `{"choices":[{"delta":{"reasoning":"hmm"}}]}`,
+			want:    `{"choices":[{"delta":{"reasoning":"hmm","reasoning_content":"hmm"}}]}`,
+			changed: true,
+		},
+		{
+			name:    "reasoning_content kept",
+			payload: `{"choices":[{"delta":{"reasoning":"hmm","reasoning_content":"other"}}]}`,
+		},
+		{
+			name:    "null reasoning",
+			payload: `{"choices":[{"delta":{"content":"hi","reasoning":null}}]}`,
+		},
+		{
+			name:    "no reasoning",
+			payload: `{"choices":[{"delta":{"content":"hi"}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := normalizeReasoning([]byte(tt.payload), "delta")
+			if changed != tt.changed {
+				t.Fatalf("expected changed=%v, got %v", tt.changed, changed)
+			}
+			if changed && string(got) != tt.want {
+				t.Errorf("unexpected payload\n got: %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Prompt Caching Tests
+// ============================================================================
+
+// systemRequest builds a request with a system instruction and a user message.
+func systemRequest(system, text string) *model.LLMRequest {
+	req := userRequest(text)
+	req.Config = &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(system, "system"),
+	}
+	return req
+}
+
+// firstMessageContent returns the content of the first message in a decoded body.
+func firstMessageContent(t *testing.T, body map[string]any) any {
+	t.Helper()
+	messages, ok := body["messages"].([]any)
+	if !ok || len(messages) == 0 {
+		t.Fatalf("expected messages in request body, got %v", body["messages"])
+	}
+	return messages[0].(map[string]any)["content"]
+}
+
+func TestPromptCaching_MarksSystemMessage(t *testing.T) {
+	var body map[string]any
+	server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+	m, err := NewOpenRouterModel("anthropic/claude-3.5-sonnet", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithCacheSystemPrompt())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := collect(m.GenerateContent(context.Background(), systemRequest("You are a helpful assistant.", "Hi"), false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parts, ok := firstMessageContent(t, body).([]any)
+	if !ok || len(parts) != 1 {
+		t.Fatalf("expected system content as a single part, got %v", firstMessageContent(t, body))
+	}
+	part := parts[0].(map[string]any)
+	if part["type"] != "text" || part["text"] != "You are a helpful assistant." {
+		t.Errorf("unexpected system part: %v", part)
+	}
+	cacheControl, ok := part["cache_control"].(map[string]any)
+	if !ok || cacheControl["type"] != "ephemeral" {
+		t.Errorf("expected ephemeral cache_control, got %v", part["cache_control"])
+	}
+}
+
+func TestPromptCaching_NoOp(t *testing.T) {
+	tests := []struct {
+		name      string
+		modelName string
+		opts      []Option
+	}{
+		{name: "not enabled", modelName: "anthropic/claude-3.5-sonnet"},
+		{name: "unsupported model", modelName: "openai/gpt-4", opts: []Option{WithCacheSystemPrompt()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			server := newStubServer(t, stubCompletion, func(r *http.Request) { body = decodeBody(t, r) })
+			opts := append([]Option{WithAPIKey("test-api-key"), WithBaseURL(server.URL)}, tt.opts...)
+			m, err := NewOpenRouterModel(tt.modelName, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, err := collect(m.GenerateContent(context.Background(), systemRequest("Be brief.", "Hi"), false)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if content := firstMessageContent(t, body); content != "Be brief." {
+				t.Errorf("expected plain system content, got %v", content)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// rewriteRequestBody Tests
+// ============================================================================
+
+func TestRewriteRequestBody_KeepsExistingFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(`{"model":"openai/gpt-4","seed":12345678901234567}`))
+
+	state := &callState{body: map[string]any{"model": "other/model", "transforms": []string{"middle-out"}}}
+	err := rewriteRequestBody(req, state.editBody)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := io.ReadAll(req.Body)
+	want := `{"model":"openai/gpt-4","seed":12345678901234567,"transforms":["middle-out"]}`
+	if string(data) != want {
+		t.Errorf("unexpected merged body\n got: %s\nwant: %s", data, want)
+	}
+	if req.ContentLength != int64(len(want)) {
+		t.Errorf("expected content length %d, got %d", len(want), req.ContentLength)
+	}
+}
+
+// ============================================================================
+// Ping Tests
+// ============================================================================
+
+// newKeyServer starts an httptest server that answers /key lookups, accepting
+// only the given API key.
+func newKeyServer(t *testing.T, apiKey string, record func(*http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if record != nil {
+			record(r)
+		}
+		if r.URL.Path != "/key" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+apiKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"No auth credentials found","code":401}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data":{"label":"test","usage":0,"limit":null}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPing_Healthy(t *testing.T) {
+	var got *http.Request
+	server := newKeyServer(t, "test-api-key", func(r *http.Request) { got = r })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), optionFunc(func(cfg *OpenRouterConfig) { cfg.AppName = "probe" }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Method != http.MethodGet {
+		t.Errorf("expected GET, got %s", got.Method)
+	}
+	if got.Header.Get("X-Title") != "probe" {
+		t.Errorf("expected configured headers on the ping, got %v", got.Header)
+	}
+}
+
+func TestPing_Unauthorized(t *testing.T) {
+	server := newKeyServer(t, "test-api-key", nil)
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("wrong-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = m.Ping(context.Background())
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestPing_Unreachable(t *testing.T) {
+	server := newKeyServer(t, "test-api-key", nil)
+	server.Close()
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = m.Ping(context.Background())
+
+	if !errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected ErrUnreachable, got %v", err)
+	}
+}
+
+func TestPing_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	m, err := NewOpenRouterModel("openai/gpt-4", WithAPIKey("test-api-key"), WithBaseURL(server.URL), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = m.Ping(context.Background())
+
+	if !errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected ErrUnreachable after the timeout, got %v", err)
+	}
+}